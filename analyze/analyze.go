@@ -0,0 +1,180 @@
+// Package analyze finds credentials, other secrets and key material in files looted from SCCM
+// distribution points.
+//
+// The analyzers take the path of a file, or a Document read once whose methods run them all on its
+// shared text and XML tree.
+// A Scanner runs a set of rules over the text of each file and returns Findings, which are written
+// as JSON lines to a FindingsFile. ExtractCredentials decodes the credentials stored by formats
+// that are known, such as unattend files and registry exports, which are written to a CredentialsFile.
+// ParseDeployment lists the steps of task sequences and applications, written to a DeploymentsFile, and
+// AnalyzeKeyMaterial describes certificates and keys, written to a KeyMaterialFile.
+package analyze
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FindingsFileName is the name of the findings file saved in the output directory of a DP
+const FindingsFileName = "findings.jsonl"
+
+// DeploymentsFileName is the name of the file of task sequences and applications saved in the output
+// directory of a DP
+const DeploymentsFileName = "deployments.jsonl"
+
+// KeyMaterialFileName is the name of the file of certificates and keys saved in the output directory of a DP
+const KeyMaterialFileName = "certificates.jsonl"
+
+// CredentialsFileName is the name of the credentials file saved in the output directory of a DP
+const CredentialsFileName = "credentials.jsonl"
+
+// Finding is a secret, or a line that very likely holds one, found in a file
+type Finding struct {
+	File string `json:"file"`
+	// Line is the 1-based line of the finding, 0 if it is not tied to a line
+	Line int    `json:"line,omitempty"`
+	Rule string `json:"rule"`
+	// Preview is the text of the finding with the secret redacted
+	Preview string `json:"preview"`
+	// User is the account the secret belongs to, if the rule found one
+	User string `json:"user,omitempty"`
+	// Secret is the secret in clear, for the rules that decrypt it (i.e. GPP cpassword attributes)
+	Secret string `json:"secret,omitempty"`
+	// ContentID and OriginalPath locate the file on the DP, when known
+	ContentID    string `json:"content_id,omitempty"`
+	OriginalPath string `json:"original_path,omitempty"`
+}
+
+// Credential is an account and its secret decoded from a file that stores it, such as an answer file
+type Credential struct {
+	User   string `json:"user,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	Secret string `json:"secret"`
+	// Source is the setting the credential comes from, i.e. "unattend:AutoLogon" or "reg:Winlogon"
+	Source string `json:"source"`
+	File   string `json:"file"`
+	// ContentID and OriginalPath locate the file on the DP, when known
+	ContentID    string `json:"content_id,omitempty"`
+	OriginalPath string `json:"original_path,omitempty"`
+}
+
+// FindingsFile is a JSON lines file of findings, safe for concurrent use. It is created on the
+// first write, so no empty file is left when nothing is found.
+type FindingsFile struct {
+	jsonLines
+}
+
+// NewFindingsFile returns a FindingsFile writing to path, which is truncated unless appending is set
+func NewFindingsFile(path string, appending bool) *FindingsFile {
+	return &FindingsFile{jsonLines{path: path, append: appending}}
+}
+
+// Write appends findings to the file
+func (f *FindingsFile) Write(findings ...Finding) error {
+	values := make([]any, len(findings))
+	for i := range findings {
+		values[i] = findings[i]
+	}
+	return f.write(values)
+}
+
+// CredentialsFile is a JSON lines file of credentials, safe for concurrent use. It is created on the
+// first write, so no empty file is left when nothing is found.
+type CredentialsFile struct {
+	jsonLines
+}
+
+// NewCredentialsFile returns a CredentialsFile writing to path, which is truncated unless appending is set
+func NewCredentialsFile(path string, appending bool) *CredentialsFile {
+	return &CredentialsFile{jsonLines{path: path, append: appending}}
+}
+
+// Write appends credentials to the file
+func (f *CredentialsFile) Write(credentials ...Credential) error {
+	values := make([]any, len(credentials))
+	for i := range credentials {
+		values[i] = credentials[i]
+	}
+	return f.write(values)
+}
+
+// DeploymentsFile is a JSON lines file of deployments, safe for concurrent use. It is created on the
+// first write, so no empty file is left when nothing is found.
+type DeploymentsFile struct {
+	jsonLines
+}
+
+// NewDeploymentsFile returns a DeploymentsFile writing to path, which is truncated unless appending is set
+func NewDeploymentsFile(path string, appending bool) *DeploymentsFile {
+	return &DeploymentsFile{jsonLines{path: path, append: appending}}
+}
+
+// Write appends deployment to the file
+func (f *DeploymentsFile) Write(deployment *Deployment) error {
+	return f.write([]any{deployment})
+}
+
+// KeyMaterialFile is a JSON lines file of certificate and key files, safe for concurrent use. It is
+// created on the first write, so no empty file is left when nothing is found.
+type KeyMaterialFile struct {
+	jsonLines
+}
+
+// NewKeyMaterialFile returns a KeyMaterialFile writing to path, which is truncated unless appending is set
+func NewKeyMaterialFile(path string, appending bool) *KeyMaterialFile {
+	return &KeyMaterialFile{jsonLines{path: path, append: appending}}
+}
+
+// Write appends material to the file
+func (f *KeyMaterialFile) Write(material *KeyMaterial) error {
+	return f.write([]any{material})
+}
+
+// jsonLines is a JSON lines file opened on the first write
+type jsonLines struct {
+	path   string
+	append bool
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// write appends values to the file, one per line
+func (f *jsonLines) write(values []any) error {
+	if len(values) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if f.append {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(f.path, flags, 0644)
+		if err != nil {
+			return err
+		}
+		f.file, f.enc = file, json.NewEncoder(file)
+		// Values hold XML and scripts, which are unreadable escaped
+		f.enc.SetEscapeHTML(false)
+	}
+	for _, value := range values {
+		if err := f.enc.Encode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the file, if anything was written to it
+func (f *jsonLines) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
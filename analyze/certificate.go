@@ -0,0 +1,424 @@
+package analyze
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Formats of KeyMaterial
+const (
+	FormatPEM    = "pem"
+	FormatDER    = "der"
+	FormatPKCS12 = "pkcs12"
+	FormatJKS    = "jks"
+)
+
+// keyMaterialExtensions are the extensions of the files AnalyzeKeyMaterial reads
+var keyMaterialExtensions = []string{".pfx", ".p12", ".pem", ".cer", ".crt", ".der", ".key", ".certs", ".keystore", ".jks"}
+
+// CommonPasswords are the passwords tried on PKCS#12 files and Java key stores: empty, the defaults of
+// tools that export them (i.e. mimikatz and keytool) and common ones
+var CommonPasswords = []string{
+	"", "mimikatz", "changeit", "changeme", "password", "Password", "Password1", "Password123", "P@ssw0rd",
+	"Passw0rd", "Passw0rd!", "123456", "12345678", "1234", "pfx", "cert", "certificate", "secret",
+	"admin", "test", "sccm", "SCCM", "Welcome1",
+}
+
+// KeyMaterial is what a certificate, key, PKCS#12 or Java key store file holds
+type KeyMaterial struct {
+	File string `json:"file"`
+	// Format is FormatPEM, FormatDER, FormatPKCS12 or FormatJKS
+	Format       string            `json:"format"`
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+	// PrivateKey is set if the file holds a private key, even one that could not be decrypted
+	PrivateKey bool `json:"private_key"`
+	// ClientAuth is set if a certificate of the file can authenticate a client, i.e. with PKINIT or Schannel
+	ClientAuth bool `json:"client_auth"`
+	// Password is the password that opened a PKCS#12 file or key store, which may be empty
+	Password *string `json:"password,omitempty"`
+	// Locked is set if none of the passwords tried opened a PKCS#12 file or key store
+	Locked bool `json:"locked,omitempty"`
+	// Hash is the pfx2john or keystore2john hash of a locked file, for John the Ripper
+	Hash  string `json:"hash,omitempty"`
+	Error string `json:"error,omitempty"`
+	// ContentID and OriginalPath locate the file on the DP, when known
+	ContentID    string `json:"content_id,omitempty"`
+	OriginalPath string `json:"original_path,omitempty"`
+}
+
+// CertificateInfo is a certificate of a KeyMaterial
+type CertificateInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	// EKUs are the extended key usages, by name for the known ones and by OID for the others
+	EKUs []string `json:"ekus,omitempty"`
+	// SANs are the DNS names, email addresses and URIs of the subject alternative name
+	SANs []string `json:"sans,omitempty"`
+	CA   bool     `json:"ca,omitempty"`
+	// ClientAuth is set for client authentication, smart card logon, PKINIT and any purpose EKUs, or
+	// no EKU at all on a certificate that is not a CA
+	ClientAuth bool `json:"client_auth"`
+}
+
+var ekuNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "server-auth",
+	x509.ExtKeyUsageClientAuth:      "client-auth",
+	x509.ExtKeyUsageCodeSigning:     "code-signing",
+	x509.ExtKeyUsageEmailProtection: "email-protection",
+	x509.ExtKeyUsageTimeStamping:    "time-stamping",
+	x509.ExtKeyUsageOCSPSigning:     "ocsp-signing",
+}
+
+// Microsoft and Kerberos EKUs that x509 does not know
+const (
+	oidSmartCardLogon   = "1.3.6.1.4.1.311.20.2.2"
+	oidPKINITClient     = "1.3.6.1.5.2.3.4"
+	oidCertRequestAgent = "1.3.6.1.4.1.311.20.2.1"
+	oidEFS              = "1.3.6.1.4.1.311.10.3.4"
+)
+
+var oidEKUNames = map[string]string{
+	oidSmartCardLogon:   "smartcard-logon",
+	oidPKINITClient:     "pkinit-client",
+	oidCertRequestAgent: "certificate-request-agent",
+	oidEFS:              "efs",
+}
+
+// AnalyzeKeyMaterial returns what the certificate, key, PKCS#12 or Java key store file at path holds,
+// trying passwords on PKCS#12 files and key stores. Other files, by extension or content, are skipped.
+func AnalyzeKeyMaterial(path string, passwords []string) (*KeyMaterial, error) {
+	doc, err := ReadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return documentKeyMaterial(doc, passwords), nil
+}
+
+// documentKeyMaterial returns what the document holds, or nil if it is not key material
+func documentKeyMaterial(doc *Document, passwords []string) *KeyMaterial {
+	if doc.data == nil || !slices.Contains(keyMaterialExtensions, doc.ext()) {
+		return nil
+	}
+	material := analyzeKeyMaterial(doc.data, passwords, doc.name())
+	if material != nil {
+		material.File = doc.Path
+	}
+	return material
+}
+
+// analyzeKeyMaterial returns what data holds, or nil if it is not key material. name is the file
+// name for the hash of a locked file.
+func analyzeKeyMaterial(data []byte, passwords []string, name string) *KeyMaterial {
+	var material *KeyMaterial
+	switch {
+	case len(data) >= 4 && (binary.BigEndian.Uint32(data) == jksMagic || binary.BigEndian.Uint32(data) == jceksMagic):
+		material = parseJKS(data, passwords, name)
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		material = parsePEM(data)
+	default:
+		if material = parsePKCS12(data, passwords, name); material == nil {
+			material = parseDER(data)
+		}
+	}
+	if material == nil {
+		return nil
+	}
+	for _, cert := range material.Certificates {
+		material.ClientAuth = material.ClientAuth || cert.ClientAuth
+	}
+	return material
+}
+
+// parsePEM returns the certificates and keys of PEM blocks, nil if there are none
+func parsePEM(data []byte) *KeyMaterial {
+	material := &KeyMaterial{Format: FormatPEM}
+	found := false
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			found = true
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				material.Error = err.Error()
+				continue
+			}
+			material.Certificates = append(material.Certificates, certificateInfo(cert))
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			// Encrypted keys (ENCRYPTED PRIVATE KEY or Proc-Type: 4,ENCRYPTED) are reported as present
+			found = true
+			material.PrivateKey = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return material
+}
+
+// parseDER returns the certificates or private key of DER data, nil if it is neither
+func parseDER(data []byte) *KeyMaterial {
+	if certs, err := x509.ParseCertificates(data); err == nil && len(certs) > 0 {
+		material := &KeyMaterial{Format: FormatDER}
+		for _, cert := range certs {
+			material.Certificates = append(material.Certificates, certificateInfo(cert))
+		}
+		return material
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return &KeyMaterial{Format: FormatDER, PrivateKey: true}
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return &KeyMaterial{Format: FormatDER, PrivateKey: true}
+	}
+	return nil
+}
+
+func certificateInfo(cert *x509.Certificate) CertificateInfo {
+	info := CertificateInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
+		NotBefore:    cert.NotBefore.UTC(),
+		NotAfter:     cert.NotAfter.UTC(),
+		CA:           cert.IsCA,
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		name, ok := ekuNames[eku]
+		if !ok {
+			name = fmt.Sprintf("eku-%d", eku)
+		}
+		info.EKUs = append(info.EKUs, name)
+		info.ClientAuth = info.ClientAuth || eku == x509.ExtKeyUsageClientAuth || eku == x509.ExtKeyUsageAny
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		name, ok := oidEKUNames[oid.String()]
+		if !ok {
+			name = oid.String()
+		}
+		info.EKUs = append(info.EKUs, name)
+		info.ClientAuth = info.ClientAuth || oid.String() == oidSmartCardLogon || oid.String() == oidPKINITClient
+	}
+	// A certificate without EKUs is good for any purpose
+	if len(info.EKUs) == 0 && !cert.IsCA {
+		info.ClientAuth = true
+	}
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	info.SANs = append(info.SANs, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		info.SANs = append(info.SANs, uri.String())
+	}
+	return info
+}
+
+// parsePKCS12 returns what a PKCS#12 file holds if one of passwords opens it, or its hash if none
+// does. It returns nil if data is not PKCS#12.
+func parsePKCS12(data []byte, passwords []string, name string) *KeyMaterial {
+	var pfx pfxPDU
+	if rest, err := asn1.Unmarshal(data, &pfx); err != nil || len(rest) > 0 || pfx.Version != 3 {
+		return nil
+	}
+	material := &KeyMaterial{Format: FormatPKCS12}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		material.Error = "unsupported PKCS#12 content: " + err.Error()
+		return material
+	}
+
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) == 0 {
+		material.Error = "PKCS#12 file without a MAC"
+		return material
+	}
+	mac, ok := pkcs12MACs[pfx.MacData.Mac.Algorithm.Algorithm.String()]
+	if !ok {
+		material.Error = "unsupported PKCS#12 MAC algorithm: " + pfx.MacData.Mac.Algorithm.Algorithm.String()
+		return material
+	}
+	// Above the limit, only the hash is reported, for offline cracking
+	if err := checkIterations(pfx.MacData.iterations()); err != nil {
+		material.Error = "PKCS#12 MAC " + err.Error() + ", passwords not tried"
+	} else {
+		tried := passwords
+		if limit := maxPKCS12Work / pfx.MacData.iterations(); len(tried) > limit {
+			tried = tried[:limit]
+		}
+		for _, password := range tried {
+			if pfx.MacData.verify(mac, authSafe, password) {
+				material.Password = &password
+				break
+			}
+		}
+		if material.Password == nil && len(tried) < len(passwords) {
+			material.Error = fmt.Sprintf("only the first %d of %d passwords tried at %d PKCS#12 MAC iterations", len(tried), len(passwords), pfx.MacData.iterations())
+		}
+	}
+	if material.Password == nil {
+		material.Locked = true
+		material.Hash = fmt.Sprintf("%s:$pfxng$%d$%d$%d$%d$%x$%x$%x:::::%s", name, mac.id, mac.size, pfx.MacData.iterations(),
+			len(pfx.MacData.MacSalt), pfx.MacData.MacSalt, authSafe, pfx.MacData.Mac.Digest, name)
+		return material
+	}
+
+	blocks, err := decodePKCS12(authSafe, *material.Password)
+	if err != nil {
+		material.Error = err.Error()
+		return material
+	}
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				material.Error = err.Error()
+				continue
+			}
+			material.Certificates = append(material.Certificates, certificateInfo(cert))
+		case "PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+			material.PrivateKey = true
+		}
+	}
+	return material
+}
+
+// JKS and JCEKS key store magic numbers
+const (
+	jksMagic   = 0xFEEDFEED
+	jceksMagic = 0xCECECECE
+)
+
+// parseJKS returns what a Java key store holds: its certificates, which are not encrypted, whether it
+// has private keys and the store password if one of passwords is, or its hash if none is
+func parseJKS(data []byte, passwords []string, name string) *KeyMaterial {
+	material := &KeyMaterial{Format: FormatJKS}
+	if len(data) < 12+sha1.Size {
+		material.Error = "truncated key store"
+		return material
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+
+	// The store is a header, then entries that are a private key and its certificate chain, a trusted
+	// certificate or, in JCEKS stores, a serialized secret key
+	r := &jksReader{data: body[4:]}
+	version := r.uint32()
+	count := r.uint32()
+	var keyCount int
+	var lastKey []byte
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		r.utf() // alias
+		r.bytes(8)
+		switch tag {
+		case 1:
+			keyCount++
+			material.PrivateKey = true
+			lastKey = r.bytes(int(r.uint32()))
+			chain := r.uint32()
+			for j := uint32(0); j < chain && r.err == nil; j++ {
+				material.addJKSCertificate(r, version)
+			}
+		case 2:
+			material.addJKSCertificate(r, version)
+		default:
+			// Secret keys are Java serialized objects, which cannot be skipped without decoding them
+			material.PrivateKey = true
+			r.err = fmt.Errorf("unsupported key store entry type %d", tag)
+		}
+	}
+	if r.err != nil {
+		material.Error = r.err.Error()
+	}
+
+	// The digest is the SHA-1 of the password as UTF-16BE, "Mighty Aphrodite" and the store
+	for _, password := range passwords {
+		h := sha1.New()
+		h.Write(utf16BE(password))
+		h.Write([]byte("Mighty Aphrodite"))
+		h.Write(body)
+		if bytes.Equal(h.Sum(nil), digest) {
+			material.Password = &password
+			return material
+		}
+	}
+	material.Locked = true
+	material.Hash = fmt.Sprintf("%s:$keystore$0$%d$%s$%s$%d$%d$%s:::::%s", name, len(body), hex.EncodeToString(body),
+		hex.EncodeToString(digest), keyCount, len(lastKey), hex.EncodeToString(lastKey), name)
+	return material
+}
+
+// addJKSCertificate reads a certificate of a key store entry
+func (m *KeyMaterial) addJKSCertificate(r *jksReader, version uint32) {
+	if version == 2 {
+		r.utf() // type, i.e. X.509
+	}
+	der := r.bytes(int(r.uint32()))
+	if r.err != nil {
+		return
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		m.Error = err.Error()
+		return
+	}
+	m.Certificates = append(m.Certificates, certificateInfo(cert))
+}
+
+// jksReader reads the big-endian fields of a key store, keeping the first error
+type jksReader struct {
+	data []byte
+	err  error
+}
+
+func (r *jksReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = fmt.Errorf("truncated key store")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *jksReader) utf() string {
+	if b := r.bytes(2); b != nil {
+		return string(r.bytes(int(binary.BigEndian.Uint16(b))))
+	}
+	return ""
+}
+
+// utf16BE returns s as UTF-16BE without a terminator
+func utf16BE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.BigEndian.PutUint16(b[2*i:], unit)
+	}
+	return b
+}
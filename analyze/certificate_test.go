@@ -0,0 +1,217 @@
+package analyze
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The files of testdata/pkcs12 hold the same self-signed client authentication certificate for
+// CN=svc_sccm,O=CORP and its P-256 key, exported by OpenSSL 3 with:
+//
+//	aes256-sha256.pfx       the defaults (PBES2 with AES-256 and HMAC-SHA256, SHA-256 MAC), password mimikatz
+//	legacy-rc2-sha1.pfx     -legacy (40-bit RC2 certificates, SHA-1 MAC), password mimikatz
+//	locked.pfx              the defaults, password Tr0ub4dor3
+//	empty-password.pfx      -nokeys, empty password
+//	high-iterations.pfx     -iter 2000000, password mimikatz
+//	max-iterations.pfx      -iter 100000, password mimikatz
+//	aes128-sha512.pfx       -keypbe AES-128-CBC -certpbe AES-128-CBC -macalg sha512, password mimikatz
+//
+// and with the settings of the Windows certificate export (2000 iterations, a CSP name and a GUID
+// friendly name), password mimikatz:
+//
+//	aes256-sha256-2000.pfx  AES256-SHA256: -keypbe AES-256-CBC -certpbe AES-256-CBC -macalg sha256
+//	3des-sha1.pfx           TripleDES-SHA1: -keypbe PBE-SHA1-3DES -certpbe PBE-SHA1-3DES -macalg sha1
+func TestAnalyzeKeyMaterialPKCS12(t *testing.T) {
+	tests := []struct {
+		file      string
+		passwords []string
+		// password is the password found, if any
+		password   *string
+		privateKey bool
+		// hash is the start of the hash of a locked file
+		hash  string
+		error string
+	}{
+		{file: "aes256-sha256.pfx", password: ptr("mimikatz"), privateKey: true},
+		{file: "legacy-rc2-sha1.pfx", password: ptr("mimikatz"), privateKey: true},
+		{file: "locked.pfx", hash: "locked.pfx:$pfxng$256$32$2048$8$"},
+		{file: "locked.pfx", passwords: []string{"Tr0ub4dor3"}, password: ptr("Tr0ub4dor3"), privateKey: true},
+		{file: "empty-password.pfx", password: ptr("")},
+		{file: "high-iterations.pfx", hash: "high-iterations.pfx:$pfxng$256$32$2000000$8$", error: "above the limit"},
+		{file: "max-iterations.pfx", password: ptr("mimikatz"), privateKey: true},
+		{file: "aes128-sha512.pfx", password: ptr("mimikatz"), privateKey: true},
+		{file: "aes256-sha256-2000.pfx", password: ptr("mimikatz"), privateKey: true},
+		{file: "3des-sha1.pfx", password: ptr("mimikatz"), privateKey: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			material, err := AnalyzeKeyMaterial(filepath.Join("testdata", "pkcs12", tt.file), append(CommonPasswords, tt.passwords...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if material == nil || material.Format != FormatPKCS12 {
+				t.Fatalf("AnalyzeKeyMaterial() = %+v, want a PKCS#12 file", material)
+			}
+			if tt.password == nil {
+				if material.Password != nil || !material.Locked || !strings.HasPrefix(material.Hash, tt.hash) {
+					t.Errorf("AnalyzeKeyMaterial() = %+v, want locked with hash %s...", material, tt.hash)
+				}
+			} else if material.Password == nil || *material.Password != *tt.password || material.Locked {
+				t.Errorf("AnalyzeKeyMaterial() = %+v, want password %q", material, *tt.password)
+			}
+			if !strings.Contains(material.Error, tt.error) || (tt.error == "" && material.Error != "") {
+				t.Errorf("Error = %q, want %q", material.Error, tt.error)
+			}
+			if tt.password == nil {
+				return
+			}
+			if material.PrivateKey != tt.privateKey {
+				t.Errorf("PrivateKey = %v, want %v", material.PrivateKey, tt.privateKey)
+			}
+			if len(material.Certificates) != 1 || material.Certificates[0].Subject != "CN=svc_sccm,O=CORP" || !material.ClientAuth {
+				t.Errorf("Certificates = %+v", material.Certificates)
+			}
+		})
+	}
+}
+
+func TestPKCS12WorkLimit(t *testing.T) {
+	defer func(work int) { maxPKCS12Work = work }(maxPKCS12Work)
+	// Room for two passwords at the 2048 iterations of locked.pfx
+	maxPKCS12Work = 2 * 2048
+	passwords := []string{"wrong", "wrong again", "Tr0ub4dor3"}
+	material, err := AnalyzeKeyMaterial(filepath.Join("testdata", "pkcs12", "locked.pfx"), passwords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if material == nil || material.Password != nil || !material.Locked || !strings.Contains(material.Error, "only the first 2 of 3 passwords") {
+		t.Errorf("AnalyzeKeyMaterial() = %+v, want locked after 2 passwords", material)
+	}
+}
+
+func TestRC2(t *testing.T) {
+	// RFC 2268 section 5
+	tests := []struct {
+		key           string
+		effectiveBits int
+		plaintext     string
+		ciphertext    string
+	}{
+		{"0000000000000000", 63, "0000000000000000", "ebb773f993278eff"},
+		{"ffffffffffffffff", 64, "ffffffffffffffff", "278b27e42e2f0d49"},
+		{"3000000000000000", 64, "1000000000000001", "30649edf9be7d2c2"},
+		{"88", 64, "0000000000000000", "61a8a244adacccf0"},
+		{"88bca90e90875a", 64, "0000000000000000", "6ccf4308974c267f"},
+		{"88bca90e90875a7f0f79c384627bafb2", 64, "0000000000000000", "1a807d272bbe5db1"},
+		{"88bca90e90875a7f0f79c384627bafb2", 128, "0000000000000000", "2269552ab0f85ca6"},
+	}
+	for _, tt := range tests {
+		block := newRC2(mustHex(tt.key), tt.effectiveBits)
+		got := make([]byte, rc2BlockSize)
+		block.Encrypt(got, mustHex(tt.plaintext))
+		if hex.EncodeToString(got) != tt.ciphertext {
+			t.Errorf("RC2 %s/%d: Encrypt(%s) = %x, want %s", tt.key, tt.effectiveBits, tt.plaintext, got, tt.ciphertext)
+		}
+		block.Decrypt(got, mustHex(tt.ciphertext))
+		if hex.EncodeToString(got) != tt.plaintext {
+			t.Errorf("RC2 %s/%d: Decrypt(%s) = %x, want %s", tt.key, tt.effectiveBits, tt.ciphertext, got, tt.plaintext)
+		}
+	}
+}
+
+func TestAnalyzeKeyMaterialJKS(t *testing.T) {
+	store := jksStore(t, "changeit")
+	tests := []struct {
+		name      string
+		data      []byte
+		passwords []string
+		password  *string
+		error     string
+	}{
+		{name: "common password", data: store, passwords: CommonPasswords, password: ptr("changeit")},
+		{name: "locked", data: store, passwords: []string{"", "password"}},
+		{name: "truncated", data: append(bytes.Clone(store[:40]), make([]byte, sha1.Size)...), passwords: CommonPasswords, error: "truncated key store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			material := analyzeKeyMaterial(tt.data, tt.passwords, "truststore.jks")
+			if material == nil || material.Format != FormatJKS || material.Error != tt.error {
+				t.Fatalf("analyzeKeyMaterial() = %+v", material)
+			}
+			if tt.password == nil {
+				if material.Password != nil || !material.Locked || !strings.HasPrefix(material.Hash, "truststore.jks:$keystore$0$") {
+					t.Errorf("analyzeKeyMaterial() = %+v, want locked", material)
+				}
+			} else if material.Password == nil || *material.Password != *tt.password {
+				t.Errorf("analyzeKeyMaterial() = %+v, want password %q", material, *tt.password)
+			}
+			if tt.error == "" && (len(material.Certificates) != 1 || material.Certificates[0].Subject != "CN=SCCM Root CA") {
+				t.Errorf("Certificates = %+v", material.Certificates)
+			}
+		})
+	}
+}
+
+// jksStore returns a JKS trust store with a CA certificate, protected by password as keytool does
+func jksStore(t *testing.T, password string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "SCCM Root CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utf := func(b []byte, s string) []byte {
+		return append(binary.BigEndian.AppendUint16(b, uint16(len(s))), s...)
+	}
+	body := binary.BigEndian.AppendUint32(nil, jksMagic)
+	body = binary.BigEndian.AppendUint32(body, 2)
+	body = binary.BigEndian.AppendUint32(body, 1)
+	// A trusted certificate entry: alias, creation time, type and certificate
+	body = binary.BigEndian.AppendUint32(body, 2)
+	body = utf(body, "sccm-root")
+	body = binary.BigEndian.AppendUint64(body, uint64(time.Now().UnixMilli()))
+	body = utf(body, "X.509")
+	body = binary.BigEndian.AppendUint32(body, uint32(len(der)))
+	body = append(body, der...)
+
+	h := sha1.New()
+	h.Write(utf16BE(password))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	return h.Sum(body)
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,45 @@
+package analyze
+
+import "strings"
+
+// ExtractCredentials returns the credentials stored in the file at path, if it is an XML (answer file
+// or task sequence) or .reg file in a format that is known. Other files, and very large ones, are skipped.
+func ExtractCredentials(path string) ([]Credential, error) {
+	doc, err := ReadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return extractCredentials(doc), nil
+}
+
+// extractCredentials returns the credentials stored in the document
+func extractCredentials(doc *Document) []Credential {
+	var credentials []Credential
+	switch doc.ext() {
+	case ".xml":
+		if root := doc.xml(); root != nil {
+			credentials = append(unattendCredentials(root), deploymentCredentials(doc.parsedDeployment())...)
+		}
+	case ".reg":
+		if text, ok := doc.decoded(); ok {
+			credentials = registryCredentials(text)
+		}
+	}
+	for i := range credentials {
+		credentials[i].File = doc.Path
+	}
+	return credentials
+}
+
+// splitAccount splits a DOMAIN\user or user@domain account name, keeping domain if it has none
+func splitAccount(account, domain string) (string, string) {
+	if before, after, ok := strings.Cut(account, `\`); ok {
+		return after, before
+	}
+	if domain == "" {
+		if before, after, ok := strings.Cut(account, "@"); ok {
+			return before, after
+		}
+	}
+	return account, domain
+}
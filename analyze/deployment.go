@@ -0,0 +1,238 @@
+package analyze
+
+import "strings"
+
+// Kinds of Deployment
+const (
+	KindTaskSequence = "task-sequence"
+	KindApplication  = "application"
+)
+
+// Deployment is what a task sequence or an application (its SDM package or AppMgmtDigest XML)
+// runs, step by step
+type Deployment struct {
+	File string `json:"file"`
+	// Kind is KindTaskSequence or KindApplication
+	Kind string `json:"kind"`
+	Name string `json:"name,omitempty"`
+	// Variables are the global variables of a task sequence
+	Variables map[string]string `json:"variables,omitempty"`
+	Steps     []Step            `json:"steps"`
+	// ContentID and OriginalPath locate the file on the DP, when known
+	ContentID    string `json:"content_id,omitempty"`
+	OriginalPath string `json:"original_path,omitempty"`
+}
+
+// Step is a task sequence step, or the deployment type of an application
+type Step struct {
+	Name string `json:"name"`
+	// Group is the path of the groups of a task sequence step, i.e. "Setup/Install apps"
+	Group string `json:"group,omitempty"`
+	// Type is the action of a task sequence step (i.e. SMS_TaskSequence_RunCommandLineAction), or the
+	// installer technology of a deployment type (i.e. MSI or Script)
+	Type        string `json:"type,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+	CommandLine string `json:"command_line,omitempty"`
+	// RunAs is the account the step runs as or connects with, or the execution context of a deployment
+	// type (System or User)
+	RunAs     string            `json:"run_as,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// tsAccounts are the task sequence variables holding an account and its password, with the source
+// of their credentials
+var tsAccounts = []struct {
+	user, password, source string
+}{
+	{"OSDJoinAccount", "OSDJoinPassword", "ts:DomainJoin"},
+	{"", "OSDLocalAdminPassword", "ts:LocalAdmin"},
+	{"SMSConnectNetworkFolderAccount", "SMSConnectNetworkFolderPassword", "ts:ConnectNetworkFolder"},
+	{"SMSTSRunCommandLineUserName", "SMSTSRunCommandLinePassword", "ts:RunCommandLine"},
+	{"SMSTSRunPowerShellUserName", "SMSTSRunPowerShellPassword", "ts:RunPowerShell"},
+	{"NetworkAccessUsername", "NetworkAccessPassword", "ts:NetworkAccess"},
+}
+
+// ParseDeployment returns what the task sequence or application XML file at path runs, or nil if it
+// is neither
+func ParseDeployment(path string) (*Deployment, error) {
+	doc, err := ReadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Deployment(), nil
+}
+
+// parseDeployment returns what the task sequence or application XML element root runs, or nil if it
+// is neither
+func parseDeployment(root *xmlNode) *Deployment {
+	if sequence := findSequence(root); sequence != nil {
+		return parseTaskSequence(sequence)
+	}
+	if root.is("AppMgmtDigest") || root.is("Application") && root.child("DeploymentType") != nil {
+		return parseApplication(root)
+	}
+	return nil
+}
+
+// findSequence returns the sequence element of a task sequence, which policies embed as text
+func findSequence(root *xmlNode) *xmlNode {
+	var sequence *xmlNode
+	root.walk(func(n *xmlNode) {
+		switch {
+		case sequence != nil:
+		case n.is("sequence"):
+			sequence = n
+		case strings.HasPrefix(n.Text, "<sequence"):
+			if embedded, err := parseXML(n.Text); err == nil && embedded.is("sequence") {
+				sequence = embedded
+			}
+		}
+	})
+	return sequence
+}
+
+func parseTaskSequence(sequence *xmlNode) *Deployment {
+	deployment := &Deployment{Kind: KindTaskSequence, Name: sequence.attr("name"), Steps: []Step{}}
+	if vars := sequence.child("globalVarList"); vars != nil {
+		deployment.Variables = tsVariables(vars)
+	}
+
+	var walk func(n *xmlNode, groups []string)
+	walk = func(n *xmlNode, groups []string) {
+		for _, child := range n.Children {
+			switch {
+			case child.is("group"):
+				walk(child, append(groups, child.attr("name")))
+			case child.is("step"):
+				step := Step{
+					Name:     child.attr("name"),
+					Group:    strings.Join(groups, "/"),
+					Type:     child.attr("type"),
+					Disabled: child.attr("disable") == "true",
+				}
+				if vars := child.child("defaultVarList"); vars != nil {
+					step.Variables = tsVariables(vars)
+				}
+				step.CommandLine = step.Variables["CommandLine"]
+				if step.CommandLine == "" {
+					step.CommandLine = child.childText("action")
+				}
+				for _, account := range tsAccounts {
+					if account.user != "" && step.Variables[account.user] != "" {
+						step.RunAs = step.Variables[account.user]
+						break
+					}
+				}
+				deployment.Steps = append(deployment.Steps, step)
+			}
+		}
+	}
+	walk(sequence, nil)
+	return deployment
+}
+
+// tsVariables returns the variables of a variable list by name
+func tsVariables(list *xmlNode) map[string]string {
+	vars := make(map[string]string)
+	for _, variable := range list.Children {
+		if variable.is("variable") && variable.attr("name") != "" {
+			vars[variable.attr("name")] = variable.Text
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	return vars
+}
+
+func parseApplication(root *xmlNode) *Deployment {
+	deployment := &Deployment{Kind: KindApplication, Steps: []Step{}}
+	root.walk(func(n *xmlNode) {
+		switch {
+		case n.is("Application") && deployment.Name == "":
+			deployment.Name = appTitle(n)
+		case n.is("DeploymentType"):
+			step := Step{Name: appTitle(n)}
+			installer := n.child("Installer")
+			if installer == nil {
+				break
+			}
+			step.Type = installer.attr("Technology")
+			step.RunAs = installer.childText("ExecutionContext")
+			step.Variables = make(map[string]string)
+			for _, action := range installer.Children {
+				if !strings.HasSuffix(action.Name, "Action") {
+					continue
+				}
+				args := action.child("Args")
+				if args == nil {
+					continue
+				}
+				for _, arg := range args.Children {
+					name := arg.attr("Name")
+					if arg.Text == "" || name == "" {
+						continue
+					}
+					switch {
+					case action.is("InstallAction") && name == "InstallCommandLine":
+						step.CommandLine = arg.Text
+					case action.is("InstallAction") && name == "ExecutionContext" && step.RunAs == "":
+						step.RunAs = arg.Text
+					case action.is("InstallAction"):
+						step.Variables[name] = arg.Text
+					default:
+						// i.e. UninstallAction.InstallCommandLine
+						step.Variables[action.Name+"."+name] = arg.Text
+					}
+				}
+			}
+			if len(step.Variables) == 0 {
+				step.Variables = nil
+			}
+			deployment.Steps = append(deployment.Steps, step)
+		}
+	})
+	return deployment
+}
+
+// appTitle returns the title of an application or deployment type, from its display info if it has one
+func appTitle(n *xmlNode) string {
+	if info := n.child("DisplayInfo"); info != nil {
+		if title := info.child("Info"); title != nil && title.childText("Title") != "" {
+			return title.childText("Title")
+		}
+	}
+	return n.childText("Title")
+}
+
+// deploymentCredentials returns the accounts and passwords in the variables of a task sequence
+func deploymentCredentials(deployment *Deployment) []Credential {
+	if deployment == nil || deployment.Kind != KindTaskSequence {
+		return nil
+	}
+
+	var credentials []Credential
+	scopes := []map[string]string{deployment.Variables}
+	for _, step := range deployment.Steps {
+		scopes = append(scopes, step.Variables)
+	}
+	for _, vars := range scopes {
+		for _, account := range tsAccounts {
+			secret := vars[account.password]
+			if secret == "" || placeholder(secret) {
+				continue
+			}
+			user := vars[account.user]
+			if account.user == "" {
+				user = "Administrator"
+			}
+			credential := Credential{Secret: secret, Source: account.source}
+			credential.User, credential.Domain = splitAccount(user, "")
+			if account.source == "ts:DomainJoin" && credential.Domain == "" {
+				credential.Domain = vars["OSDDomainName"]
+			}
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials
+}
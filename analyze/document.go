@@ -0,0 +1,116 @@
+package analyze
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Document is a file read once and shared by the analyzers. Its text, decoded from UTF-16 if it has
+// to be, its XML tree and the deployment it describes are only worked out once, on first use.
+type Document struct {
+	// Path is the path of the file, set on the findings and credentials
+	Path string
+	// Name is the original name of the file, if Path does not end with it (i.e. a blob of the content
+	// store). Its extension tells the analyzers what the file is.
+	Name string
+	// data is the content of the file, nil if it is over maxScanSize
+	data []byte
+
+	textOnce sync.Once
+	text     string
+	isText   bool
+
+	xmlOnce sync.Once
+	root    *xmlNode
+
+	deploymentOnce sync.Once
+	deployment     *Deployment
+}
+
+// ReadDocument reads the file at path. Files over maxScanSize are not read, and skipped by every
+// analyzer.
+func ReadDocument(path string) (*Document, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewDocument(path, data), nil
+}
+
+// NewDocument returns the document of data, the content of the file at path
+func NewDocument(path string, data []byte) *Document {
+	return &Document{Path: path, data: data}
+}
+
+// name returns the original base name of the file
+func (d *Document) name() string {
+	if d.Name != "" {
+		return path.Base(strings.ReplaceAll(d.Name, `\`, "/"))
+	}
+	return filepath.Base(d.Path)
+}
+
+// ext returns the lowercase extension of the file
+func (d *Document) ext() string {
+	return strings.ToLower(filepath.Ext(d.name()))
+}
+
+// decoded returns the text of the document, or false if it is binary or was not read
+func (d *Document) decoded() (string, bool) {
+	d.textOnce.Do(func() {
+		if d.data != nil {
+			d.text, d.isText = decodeText(d.data)
+		}
+	})
+	return d.text, d.isText
+}
+
+// xml returns the root element of the document, or nil if it is not an XML file
+func (d *Document) xml() *xmlNode {
+	d.xmlOnce.Do(func() {
+		if d.ext() != ".xml" {
+			return
+		}
+		if text, ok := d.decoded(); ok {
+			d.root, _ = parseXML(text)
+		}
+	})
+	return d.root
+}
+
+// GPPPasswords returns the decrypted cpassword attributes of the document, like the GPPPasswords function
+func (d *Document) GPPPasswords() []Finding {
+	return gppPasswords(d)
+}
+
+// Credentials returns the credentials stored in the document, like ExtractCredentials
+func (d *Document) Credentials() []Credential {
+	return extractCredentials(d)
+}
+
+// Deployment returns what the task sequence or application document runs, like ParseDeployment
+func (d *Document) Deployment() *Deployment {
+	deployment := d.parsedDeployment()
+	if deployment != nil {
+		deployment.File = d.Path
+	}
+	return deployment
+}
+
+// KeyMaterial returns what the certificate, key, PKCS#12 or Java key store document holds, like
+// AnalyzeKeyMaterial
+func (d *Document) KeyMaterial(passwords []string) *KeyMaterial {
+	return documentKeyMaterial(d, passwords)
+}
+
+// parsedDeployment returns the task sequence or application of the document, or nil if it is neither
+func (d *Document) parsedDeployment() *Deployment {
+	d.deploymentOnce.Do(func() {
+		if root := d.xml(); root != nil {
+			d.deployment = parseDeployment(root)
+		}
+	})
+	return d.deployment
+}
@@ -0,0 +1,88 @@
+package analyze
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// taskSequence is a task sequence policy, as SCCM saves it, with the sequence embedded as text
+const taskSequence = `<?xml version="1.0" encoding="utf-16"?>
+<Policy><PolicyRule><PolicyAction><instance><property name="TS_Sequence"><value>` +
+	`&lt;sequence version="3.10" name="Deploy Windows 11"&gt;&lt;globalVarList&gt;` +
+	`&lt;variable name="OSDJoinAccount" property=""&gt;CORP\svc_join&lt;/variable&gt;` +
+	`&lt;variable name="OSDJoinPassword" property=""&gt;J0in!2024&lt;/variable&gt;` +
+	`&lt;/globalVarList&gt;&lt;step type="SMS_TaskSequence_RunCommandLineAction" name="Install agent"&gt;` +
+	`&lt;action&gt;setup.exe /quiet&lt;/action&gt;&lt;/step&gt;&lt;/sequence&gt;` +
+	`</value></property></instance></PolicyAction></PolicyRule></Policy>`
+
+// utf16LE returns text as UTF-16LE with a BOM, as Windows writes XML files
+func utf16LE(text string) []byte {
+	data := []byte{0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		data = binary.LittleEndian.AppendUint16(data, unit)
+	}
+	return data
+}
+
+func TestDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Policy.xml")
+	if err := os.WriteFile(path, utf16LE(taskSequence), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ReadDocument(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployment := doc.Deployment()
+	if deployment == nil || deployment.Name != "Deploy Windows 11" || len(deployment.Steps) != 1 || deployment.File != path {
+		t.Fatalf("Deployment() = %+v, want the task sequence", deployment)
+	}
+	credentials := doc.Credentials()
+	want := Credential{File: path, User: "svc_join", Domain: "CORP", Secret: "J0in!2024", Source: "ts:DomainJoin"}
+	if len(credentials) != 1 || credentials[0] != want {
+		t.Errorf("Credentials() = %+v, want %+v", credentials, want)
+	}
+	// The analyzers that take a path read the file themselves
+	if fromPath, err := ParseDeployment(path); err != nil || fromPath == nil || fromPath.Name != deployment.Name {
+		t.Errorf("ParseDeployment(%s) = %+v, %v, want the task sequence", path, fromPath, err)
+	}
+	if fromPath, err := ExtractCredentials(path); err != nil || len(fromPath) != 1 || fromPath[0] != want {
+		t.Errorf("ExtractCredentials(%s) = %+v, %v, want %+v", path, fromPath, err, want)
+	}
+	// Every analyzer shares the tree and the deployment parsed first
+	if doc.xml() != doc.xml() || doc.parsedDeployment() != deployment {
+		t.Error("the document was parsed again")
+	}
+	if findings := doc.GPPPasswords(); findings != nil {
+		t.Errorf("GPPPasswords() = %+v, want nothing", findings)
+	}
+	if material := doc.KeyMaterial(nil); material != nil {
+		t.Errorf("KeyMaterial() = %+v, want nothing", material)
+	}
+
+	// Only XML files are parsed
+	doc = NewDocument("Policy.txt", []byte(taskSequence))
+	if deployment := doc.Deployment(); deployment != nil || doc.xml() != nil {
+		t.Errorf("Deployment() = %+v for a text file, want nil", deployment)
+	}
+	if _, ok := doc.decoded(); !ok {
+		t.Error("the text file was not decoded")
+	}
+}
+
+func TestDocumentName(t *testing.T) {
+	// A blob of the content store is named after its hash, its original name tells what it is
+	blob := NewDocument(filepath.Join("store", "0A1B", "0A1B2C"), []byte(taskSequence))
+	if deployment := blob.Deployment(); deployment != nil {
+		t.Errorf("Deployment() = %+v without the original name, want nil", deployment)
+	}
+	blob = NewDocument(filepath.Join("store", "0A1B", "0A1B2C"), []byte(taskSequence))
+	blob.Name = `Policies\Policy.XML`
+	if deployment := blob.Deployment(); deployment == nil || deployment.File != blob.Path {
+		t.Errorf("Deployment() = %+v, want the task sequence of the blob", deployment)
+	}
+}
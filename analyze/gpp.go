@@ -0,0 +1,109 @@
+package analyze
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GPPRule is the rule of the findings of GPPPasswords
+const GPPRule = "gpp-cpassword"
+
+// gppKey is the AES-256 key of Group Policy Preferences passwords, published by Microsoft in
+// [MS-GPPREF] 2.2.1.1.4
+var gppKey = []byte{
+	0x4e, 0x99, 0x06, 0xe8, 0xfc, 0xb6, 0x6c, 0xc9, 0xfa, 0xf4, 0x93, 0x10, 0x62, 0x0f, 0xfe, 0xe8,
+	0xf4, 0x96, 0xe8, 0x06, 0xcc, 0x05, 0x79, 0x90, 0x20, 0x9b, 0x09, 0xa4, 0x33, 0xb6, 0x6c, 0x1b,
+}
+
+// gppAccountAttrs are the attributes holding the account of a cpassword, by GPP file: Groups.xml
+// (newName for a renamed account), Services.xml, ScheduledTasks.xml, DataSources.xml, Drives.xml and
+// Printers.xml
+var gppAccountAttrs = []string{"newName", "userName", "accountName", "runAs", "username"}
+
+// GPPPasswords returns the decrypted cpassword attributes of the Group Policy Preferences XML file at
+// path, as findings with the password in Secret. Other files are skipped.
+func GPPPasswords(path string) ([]Finding, error) {
+	doc, err := ReadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return gppPasswords(doc), nil
+}
+
+// gppPasswords returns the decrypted cpassword attributes of a Group Policy Preferences XML document,
+// skipping those that are not valid
+func gppPasswords(doc *Document) []Finding {
+	text, ok := doc.decoded()
+	if !ok || doc.ext() != ".xml" || !strings.Contains(text, "cpassword") {
+		return nil
+	}
+	root := doc.xml()
+	if root == nil {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+
+	var findings []Finding
+	root.walk(func(n *xmlNode) {
+		cpassword := n.attr("cpassword")
+		if cpassword == "" {
+			return
+		}
+		password, err := DecryptCPassword(cpassword)
+		if err != nil {
+			return
+		}
+		finding := Finding{File: doc.Path, Rule: GPPRule, Secret: password, Preview: fmt.Sprintf(`<%s cpassword="%s">`, n.Name, redact(cpassword))}
+		for _, attr := range gppAccountAttrs {
+			if user := n.attr(attr); user != "" {
+				finding.User = user
+				break
+			}
+		}
+		// The line of the attribute, for the scanner findings of the same line to be dropped
+		for i, line := range lines {
+			if start := strings.Index(line, cpassword); start >= 0 {
+				finding.Line = i + 1
+				finding.Preview = preview(strings.TrimRight(line, "\r"), start, start, start+len(cpassword))
+				break
+			}
+		}
+		findings = append(findings, finding)
+	})
+	return findings
+}
+
+// DecryptCPassword returns the password of a Group Policy Preferences cpassword attribute, which is
+// AES-256-CBC encrypted with the published key and a zero IV, then base64 encoded without padding
+func DecryptCPassword(cpassword string) (string, error) {
+	if padding := len(cpassword) % 4; padding != 0 {
+		cpassword += strings.Repeat("=", 4-padding)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(cpassword)
+	if err != nil {
+		return "", fmt.Errorf("invalid cpassword: %w", err)
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return "", errors.New("invalid cpassword length")
+	}
+
+	block, err := aes.NewCipher(gppKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(plaintext, ciphertext)
+
+	// PKCS#7 padding
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) {
+		return "", errors.New("invalid cpassword padding")
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+	return decodeUTF16(plaintext, binary.LittleEndian), nil
+}
@@ -0,0 +1,68 @@
+package analyze
+
+import (
+	"strings"
+	"testing"
+)
+
+// groupsXML is a Groups.xml that renames the local administrator, with the cpassword of the example
+// published by Microsoft
+const groupsXML = `<?xml version="1.0" encoding="utf-8"?>
+<Groups clsid="{3125E937-EB16-4b4c-9934-544FC6D24D26}">
+	<User clsid="{DF5F1855-51E5-4d24-8B1A-D9BDE98BA1D1}" name="Administrator (built-in)" image="2" changed="2024-03-18 09:12:44" uid="{8A6E2F4C-1E0B-4B8A-9C55-3B7E0C1F9D21}">
+		<Properties action="U" newName="LocalAdm" fullName="" description="" cpassword="j1Uyj3Vx8TY9LtLZil2uAuZkFQA/4latT76ZwgdHdhw" changeLogon="0" noChange="0" neverExpires="1" acctDisabled="0" userName="Administrator (built-in)"/>
+	</User>
+	<User clsid="{DF5F1855-51E5-4d24-8B1A-D9BDE98BA1D1}" name="broken" image="2" changed="2024-03-18 09:12:44" uid="{0B3C2F4C-1E0B-4B8A-9C55-3B7E0C1F9D22}">
+		<Properties action="U" userName="broken" cpassword="not base64!"/>
+	</User>
+</Groups>
+`
+
+func TestDecryptCPassword(t *testing.T) {
+	tests := []struct {
+		cpassword string
+		want      string
+		err       string
+	}{
+		// [MS-GPPREF] and the Microsoft security bulletin MS14-025
+		{cpassword: "j1Uyj3Vx8TY9LtLZil2uAuZkFQA/4latT76ZwgdHdhw", want: "Local*P4ssword!"},
+		{cpassword: "j1Uyj3Vx8TY9LtLZil2uAuZkFQA/4latT76ZwgdHdhw=", want: "Local*P4ssword!"},
+		{cpassword: "not base64!", err: "invalid cpassword"},
+		{cpassword: "", err: "invalid cpassword length"},
+		{cpassword: "AAAAAAAAAAAAAAAAAAAA", err: "invalid cpassword length"},
+	}
+	for _, tt := range tests {
+		got, err := DecryptCPassword(tt.cpassword)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("DecryptCPassword(%q) = %q, %v, want error %q", tt.cpassword, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("DecryptCPassword(%q) = %q, %v, want %q", tt.cpassword, got, err, tt.want)
+		}
+	}
+}
+
+func TestGPPPasswords(t *testing.T) {
+	for name, data := range map[string][]byte{"utf-8": []byte(groupsXML), "utf-16": utf16LE(groupsXML)} {
+		t.Run(name, func(t *testing.T) {
+			findings := NewDocument("Groups.xml", data).GPPPasswords()
+			if len(findings) != 1 {
+				t.Fatalf("GPPPasswords() = %+v, want one finding", findings)
+			}
+			finding := findings[0]
+			if finding.File != "Groups.xml" || finding.Rule != GPPRule || finding.User != "LocalAdm" || finding.Secret != "Local*P4ssword!" || finding.Line != 4 {
+				t.Errorf("GPPPasswords() = %+v", finding)
+			}
+			if strings.Contains(finding.Preview, "j1Uyj3Vx8TY9LtLZil2uAuZkFQA/4latT76ZwgdHdhw") {
+				t.Errorf("Preview = %q, want the cpassword redacted", finding.Preview)
+			}
+		})
+	}
+
+	if findings := NewDocument("Groups.txt", []byte(groupsXML)).GPPPasswords(); findings != nil {
+		t.Errorf("GPPPasswords() = %+v for a text file, want nothing", findings)
+	}
+}
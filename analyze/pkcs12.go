@@ -0,0 +1,370 @@
+package analyze
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The PKCS#12 structures needed to check a password against the MAC of a file and to read its bags
+// (RFC 7292). This is done here, and not by x/crypto/pkcs12, because that one only supports SHA-1
+// MACs and the legacy PKCS#12 encryption schemes, while OpenSSL 3 and recent Windows versions use
+// SHA-256 and PBES2 with AES, and because the iteration counts of the file must be bounded.
+type pfxPDU struct {
+	Version  int
+	AuthSafe struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+	}
+	MacData macData `asn1:"optional"`
+}
+
+type macData struct {
+	Mac struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Digest    []byte
+	}
+	MacSalt    []byte
+	Iterations int `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           []byte `asn1:"tag:0,optional"`
+	}
+}
+
+type safeBag struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"tag:0,explicit"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// PKCS#7 content types, PKCS#12 bag types and the encryption schemes decodePKCS12 supports
+const (
+	oidDataContent      = "1.2.840.113549.1.7.1"
+	oidEncryptedContent = "1.2.840.113549.1.7.6"
+	oidKeyBag           = "1.2.840.113549.1.12.10.1.1"
+	oidShroudedKeyBag   = "1.2.840.113549.1.12.10.1.2"
+	oidCertBag          = "1.2.840.113549.1.12.10.1.3"
+	oidX509Certificate  = "1.2.840.113549.1.9.22.1"
+	oidPBEWithSHA3DES   = "1.2.840.113549.1.12.1.3"
+	oidPBEWithSHARC2    = "1.2.840.113549.1.12.1.5"
+	oidPBEWithSHARC240  = "1.2.840.113549.1.12.1.6"
+	oidPBES2            = "1.2.840.113549.1.5.13"
+	oidPBKDF2           = "1.2.840.113549.1.5.12"
+	oidDESEDE3CBC       = "1.2.840.113549.3.7"
+)
+
+// maxPKCS12Iterations is the highest iteration count of a MAC or encryption scheme that is tried. The
+// count comes from the file, and each password costs that many hashes: Windows and OpenSSL use 2000
+// to 10000, so much higher counts are only seen in files crafted to stall the scan.
+const maxPKCS12Iterations = 100_000
+
+// maxPKCS12Work bounds the MAC iterations spent on a file over all the passwords tried, so that a long
+// -passwords list does not stall the analysis either. It is a variable for the tests.
+var maxPKCS12Work = 20_000_000
+
+// pbkdf2PRFs are the hash functions of the PBKDF2 PRFs by OID, HMAC-SHA1 being the default
+var pbkdf2PRFs = map[string]func() hash.Hash{
+	"":                    sha1.New,
+	"1.2.840.113549.2.7":  sha1.New,
+	"1.2.840.113549.2.8":  sha256.New224,
+	"1.2.840.113549.2.9":  sha256.New,
+	"1.2.840.113549.2.10": sha512.New384,
+	"1.2.840.113549.2.11": sha512.New,
+	"1.2.840.113549.2.12": sha512.New512_224,
+	"1.2.840.113549.2.13": sha512.New512_256,
+}
+
+// aesKeySizes are the key sizes of the AES-CBC encryption schemes by OID
+var aesKeySizes = map[string]int{
+	"2.16.840.1.101.3.4.1.2":  16,
+	"2.16.840.1.101.3.4.1.22": 24,
+	"2.16.840.1.101.3.4.1.42": 32,
+}
+
+// pkcs12MAC is a MAC digest algorithm, with its pfx2john ID
+type pkcs12MAC struct {
+	hash func() hash.Hash
+	// size and blockSize are the u and v of the key derivation, in bytes
+	size, blockSize int
+	id              int
+}
+
+// pkcs12MACs are the MAC digest algorithms by OID
+var pkcs12MACs = map[string]pkcs12MAC{
+	"1.3.14.3.2.26":          {sha1.New, sha1.Size, sha1.BlockSize, 1},
+	"2.16.840.1.101.3.4.2.4": {sha256.New224, sha256.Size224, sha256.BlockSize, 224},
+	"2.16.840.1.101.3.4.2.1": {sha256.New, sha256.Size, sha256.BlockSize, 256},
+	"2.16.840.1.101.3.4.2.2": {sha512.New384, sha512.Size384, sha512.BlockSize, 384},
+	"2.16.840.1.101.3.4.2.3": {sha512.New, sha512.Size, sha512.BlockSize, 512},
+}
+
+func (m macData) iterations() int {
+	// The default is 1
+	return max(m.Iterations, 1)
+}
+
+// checkIterations returns an error if iterations is above maxPKCS12Iterations
+func checkIterations(iterations int) error {
+	if iterations > maxPKCS12Iterations {
+		return fmt.Errorf("iteration count %d above the limit of %d", iterations, maxPKCS12Iterations)
+	}
+	return nil
+}
+
+// verify returns whether password is the password of the MAC of content. The empty password is
+// either an empty BMPString or a lone terminator, depending on what made the file.
+func (m macData) verify(mac pkcs12MAC, content []byte, password string) bool {
+	encodings := [][]byte{append(utf16BE(password), 0, 0)}
+	if password == "" {
+		encodings = append(encodings, nil)
+	}
+	for _, encoded := range encodings {
+		key := pkcs12KDF(mac, m.MacSalt, encoded, m.iterations(), 3, mac.size)
+		h := hmac.New(mac.hash, key)
+		h.Write(content)
+		if hmac.Equal(h.Sum(nil), m.Mac.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// pkcs12KDF derives size bytes of key material for purpose id (3 for a MAC key) from password, as in
+// RFC 7292 appendix B.2
+func pkcs12KDF(mac pkcs12MAC, salt, password []byte, iterations int, id byte, size int) []byte {
+	v := mac.blockSize
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	input := append(fill(salt), fill(password)...)
+
+	var key []byte
+	for len(key) < size {
+		h := mac.hash()
+		h.Write(d)
+		h.Write(input)
+		a := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		key = append(key, a...)
+
+		// Each block of the input becomes (block + b + 1) mod 2^(8v), with b copies of a
+		b := fill(a)[:v]
+		for j := 0; j < len(input); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(input[j+k]) + int(b[k]) + carry
+				input[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return key[:size]
+}
+
+// decodePKCS12 returns the certificates and keys of the bags of authSafe, the content of a PKCS#12
+// file, as PEM blocks. Certificates encrypted with PBES2 or the PKCS#12 schemes are decrypted with
+// password, while private keys are returned as they are, encrypted or not.
+func decodePKCS12(authSafe []byte, password string) ([]*pem.Block, error) {
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#12 content: %w", err)
+	}
+
+	var blocks []*pem.Block
+	for _, content := range contents {
+		var bags []byte
+		switch content.ContentType.String() {
+		case oidDataContent:
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &bags); err != nil {
+				return nil, fmt.Errorf("invalid PKCS#12 data: %w", err)
+			}
+		case oidEncryptedContent:
+			var encrypted encryptedData
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &encrypted); err != nil {
+				return nil, fmt.Errorf("invalid PKCS#12 encrypted data: %w", err)
+			}
+			info := encrypted.EncryptedContentInfo
+			var err error
+			if bags, err = decryptPBE(info.ContentEncryptionAlgorithm, password, info.EncryptedContent); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+
+		var safeBags []safeBag
+		if _, err := asn1.Unmarshal(bags, &safeBags); err != nil {
+			return nil, fmt.Errorf("invalid PKCS#12 bags: %w", err)
+		}
+		for _, bag := range safeBags {
+			switch bag.ID.String() {
+			case oidCertBag:
+				var cert certBag
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &cert); err != nil {
+					return nil, fmt.Errorf("invalid PKCS#12 certificate bag: %w", err)
+				}
+				if cert.ID.String() == oidX509Certificate {
+					blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Data})
+				}
+			case oidKeyBag:
+				blocks = append(blocks, &pem.Block{Type: "PRIVATE KEY", Bytes: bag.Value.Bytes})
+			case oidShroudedKeyBag:
+				blocks = append(blocks, &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: bag.Value.Bytes})
+			}
+		}
+	}
+	return blocks, nil
+}
+
+// decryptPBE decrypts data encrypted with password by PBES2 (PBKDF2 and AES or 3DES) or by the PKCS#12
+// 3DES and RC2 schemes
+func decryptPBE(algorithm pkix.AlgorithmIdentifier, password string, data []byte) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	switch algorithm.Algorithm.String() {
+	case oidPBEWithSHA3DES, oidPBEWithSHARC2, oidPBEWithSHARC240:
+		var params pbeParams
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid PBE parameters: %w", err)
+		}
+		if err := checkIterations(params.Iterations); err != nil {
+			return nil, err
+		}
+		sha1MAC := pkcs12MACs["1.3.14.3.2.26"]
+		encoded := append(utf16BE(password), 0, 0)
+		keySize, blockSize := 24, des.BlockSize
+		switch algorithm.Algorithm.String() {
+		case oidPBEWithSHARC2:
+			keySize, blockSize = 16, rc2BlockSize
+		case oidPBEWithSHARC240:
+			keySize, blockSize = 5, rc2BlockSize
+		}
+		key := pkcs12KDF(sha1MAC, params.Salt, encoded, max(params.Iterations, 1), 1, keySize)
+		iv = pkcs12KDF(sha1MAC, params.Salt, encoded, max(params.Iterations, 1), 2, blockSize)
+		if keySize == 24 {
+			var err error
+			if block, err = des.NewTripleDESCipher(key); err != nil {
+				return nil, err
+			}
+		} else {
+			block = newRC2(key, keySize*8)
+		}
+
+	case oidPBES2:
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid PBES2 parameters: %w", err)
+		}
+		if params.KeyDerivationFunc.Algorithm.String() != oidPBKDF2 {
+			return nil, fmt.Errorf("unsupported PBES2 key derivation: %s", params.KeyDerivationFunc.Algorithm)
+		}
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			return nil, fmt.Errorf("invalid PBKDF2 parameters: %w", err)
+		}
+		if err := checkIterations(kdf.Iterations); err != nil {
+			return nil, err
+		}
+		prf, ok := pbkdf2PRFs[kdf.PRF.Algorithm.String()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported PBKDF2 PRF: %s", kdf.PRF.Algorithm)
+		}
+		scheme := params.EncryptionScheme.Algorithm.String()
+		keySize, isAES := aesKeySizes[scheme]
+		if !isAES && scheme != oidDESEDE3CBC {
+			return nil, fmt.Errorf("unsupported PBES2 encryption scheme: %s", scheme)
+		}
+		if !isAES {
+			keySize = 24
+		}
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, fmt.Errorf("invalid PBES2 IV: %w", err)
+		}
+		key := pbkdf2.Key([]byte(password), kdf.Salt, max(kdf.Iterations, 1), keySize, prf)
+		var err error
+		if isAES {
+			block, err = aes.NewCipher(key)
+		} else {
+			block, err = des.NewTripleDESCipher(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#12 encryption: %s", algorithm.Algorithm)
+	}
+
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid PKCS#12 encrypted data length")
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	// PKCS#7 padding
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.New("invalid PKCS#12 padding, the password may be wrong")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
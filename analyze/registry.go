@@ -0,0 +1,114 @@
+package analyze
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+// winlogonAccounts are the value names of the auto logon accounts of the Winlogon key: the password,
+// user name and domain name of the default and alternate accounts
+var winlogonAccounts = []struct {
+	password, user, domain, source string
+}{
+	{"defaultpassword", "defaultusername", "defaultdomainname", "reg:Winlogon"},
+	{"altdefaultpassword", "altdefaultusername", "altdefaultdomainname", "reg:Winlogon (alternate)"},
+}
+
+// registryCredentials returns the auto logon credentials set under the Winlogon key by a registry
+// export (.reg file)
+func registryCredentials(text string) []Credential {
+	keys := parseRegistry(text)
+	var credentials []Credential
+	for key, values := range keys {
+		if !strings.HasSuffix(strings.ToLower(key), `\winlogon`) {
+			continue
+		}
+		for _, account := range winlogonAccounts {
+			secret := values[account.password]
+			if secret == "" || placeholder(secret) {
+				continue
+			}
+			user, domain := splitAccount(values[account.user], values[account.domain])
+			credentials = append(credentials, Credential{User: user, Domain: domain, Secret: secret, Source: account.source})
+		}
+	}
+	return credentials
+}
+
+// parseRegistry returns the string values of a registry export by key and lowercase value name. It
+// returns nothing if text is not a registry export.
+func parseRegistry(text string) map[string]map[string]string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	header := strings.TrimSpace(lines[0])
+	if !strings.HasPrefix(header, "Windows Registry Editor") && !strings.HasPrefix(header, "REGEDIT4") {
+		return nil
+	}
+
+	keys := make(map[string]map[string]string)
+	var values map[string]string
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		// Long hex values continue on the next lines
+		for strings.HasSuffix(line, `\`) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimSpace(lines[i])
+		}
+		switch {
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			key := line[1 : len(line)-1]
+			if keys[key] == nil {
+				keys[key] = make(map[string]string)
+			}
+			values = keys[key]
+		case values != nil && strings.HasPrefix(line, `"`):
+			name, rest, ok := cutRegistryString(line)
+			if !ok || !strings.HasPrefix(rest, "=") {
+				continue
+			}
+			if value, ok := registryString(rest[1:]); ok {
+				values[strings.ToLower(name)] = value
+			}
+		}
+	}
+	return keys
+}
+
+// registryString returns the value of a .reg value data that is a string: "quoted" for REG_SZ, or
+// hex(1) and hex(2) for REG_SZ and REG_EXPAND_SZ saved as UTF-16LE bytes
+func registryString(data string) (string, bool) {
+	if strings.HasPrefix(data, `"`) {
+		value, _, ok := cutRegistryString(data)
+		return value, ok
+	}
+	for _, prefix := range []string{"hex(1):", "hex(2):"} {
+		if !strings.HasPrefix(data, prefix) {
+			continue
+		}
+		raw, err := hex.DecodeString(strings.NewReplacer(",", "", " ", "").Replace(data[len(prefix):]))
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimRight(decodeUTF16(raw, binary.LittleEndian), "\x00"), true
+	}
+	return "", false
+}
+
+// cutRegistryString returns the quoted string at the start of s, unescaped, and what follows it
+func cutRegistryString(s string) (string, string, bool) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,104 @@
+package analyze
+
+import "regexp"
+
+// Rule finds one kind of secret in a line of text
+type Rule struct {
+	Name string
+	// Keywords are lowercase strings of which one must be in a line before Patterns are tried
+	Keywords []string
+	// Patterns match the secret in a group named "secret" and its account, if any, in a group named "user".
+	// A pattern without a secret group flags the whole match.
+	Patterns []*regexp.Regexp
+	// MinEntropy is the minimum Shannon entropy (bits per character) of a secret, 0 for any
+	MinEntropy float64
+}
+
+// quoted matches a double quoted, single quoted or bare value as the secret
+const quoted = `(?:"(?P<secret>[^"\r\n]*)"|'(?P<secret>[^'\r\n]*)'|(?P<secret>[^\s"'/*][^\s"']*))`
+
+// DefaultRules are the rules tuned for SCCM content: deployment scripts, configuration files and
+// answer files. Specific rules come first, as a secret is only reported by the first rule that finds it.
+var DefaultRules = []Rule{
+	{
+		Name:     "private-key",
+		Keywords: []string{"private key"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED )?PRIVATE KEY-----`)},
+	},
+	{
+		Name:     "net-use-password",
+		Keywords: []string{"net use", "net.exe use"},
+		Patterns: []*regexp.Regexp{
+			// net use Z: \\server\share P@ss /user:CORP\svc
+			regexp.MustCompile(`(?i)\bnet(?:\.exe)?\s+use\s+(?:\w:\s+)?\\\\\S+\s+` + quoted + `[^\r\n]*?/u(?:ser)?:\s*(?P<user>[^\s"]+)`),
+			// net use Z: \\server\share /user:CORP\svc P@ss
+			regexp.MustCompile(`(?i)\bnet(?:\.exe)?\s+use\b[^\r\n]*?/u(?:ser)?:\s*(?P<user>[^\s"]+)\s+` + quoted),
+		},
+	},
+	{
+		Name:     "securestring-plaintext",
+		Keywords: []string{"convertto-securestring"},
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)ConvertTo-SecureString\s+(?:-String\s+)?(?:"(?P<secret>[^"\r\n]*)"|'(?P<secret>[^'\r\n]*)'|(?P<secret>\$[\w:]+))[^\r\n]*-AsPlainText`),
+			regexp.MustCompile(`(?i)ConvertTo-SecureString\b[^\r\n]*-AsPlainText[^\r\n]*?-String\s+(?:"(?P<secret>[^"\r\n]*)"|'(?P<secret>[^'\r\n]*)'|(?P<secret>\$[\w:]+))`),
+		},
+	},
+	{
+		Name:     "psexec-password",
+		Keywords: []string{"psexec"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)\bpsexec(?:64)?(?:\.exe)?\b[^\r\n]*?\s-u\s+(?P<user>[^\s"]+)\s+-p\s+` + quoted)},
+	},
+	{
+		Name:     "schtasks-password",
+		Keywords: []string{"schtasks"},
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\bschtasks(?:\.exe)?\b[^\r\n]*?/ru\s+(?P<user>"[^"]+"|\S+)[^\r\n]*?/rp\s+` + quoted),
+			regexp.MustCompile(`(?i)\bschtasks(?:\.exe)?\b[^\r\n]*?/rp\s+` + quoted),
+		},
+	},
+	{
+		Name:     "service-password",
+		Keywords: []string{"sc ", "sc.exe"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)\bsc(?:\.exe)?\s+(?:\\\\\S+\s+)?(?:config|create)\b[^\r\n]*?\bobj=\s*(?P<user>"[^"]+"|\S+)[^\r\n]*?\bpassword=\s*` + quoted)},
+	},
+	{
+		Name:     "runas",
+		Keywords: []string{"runas"},
+		// runas prompts for the password, which scripts often pipe in or cache with /savecred
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)\brunas(?:\.exe)?\b[^\r\n]*?/user:\s*(?P<user>"[^"]+"|\S+)`)},
+	},
+	{
+		Name:     "autologon-password",
+		Keywords: []string{"defaultpassword"},
+		Patterns: []*regexp.Regexp{
+			// reg add "HKLM\...\Winlogon" /v DefaultPassword /t REG_SZ /d P@ss
+			regexp.MustCompile(`(?i)/v\s+"?DefaultPassword"?\s[^\r\n]*?/d\s+` + quoted),
+			// "DefaultPassword"="P@ss" in a .reg file
+			regexp.MustCompile(`(?i)"DefaultPassword"\s*=\s*"(?P<secret>[^"\r\n]*)"`),
+			// Set-ItemProperty ... -Name DefaultPassword -Value P@ss
+			regexp.MustCompile(`(?i)-Name\s+"?DefaultPassword"?\s[^\r\n]*?-Value\s+` + quoted),
+		},
+	},
+	{
+		Name:     "connection-string",
+		Keywords: []string{"password=", "pwd=", "password =", "pwd ="},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)(?:Data Source|Server|Initial Catalog|Database|Provider|DSN)\s*=[^\r\n]*?;\s*(?:(?:User ID|UID|User)\s*=\s*(?P<user>[^;"'\r\n]+);[^\r\n]*?)?(?:Password|Pwd)\s*=\s*(?:"(?P<secret>[^"\r\n]*)"|'(?P<secret>[^'\r\n]*)'|(?P<secret>[^;"'\r\n<]+))`)},
+	},
+	{
+		Name:     "xml-password",
+		Keywords: []string{"pass", "pwd"},
+		Patterns: []*regexp.Regexp{
+			// <Password>P@ss</Password>, <AdminPassword>..., <ns:pwd>...
+			regexp.MustCompile(`(?i)<(?:\w+:)?\w*(?:password|passwd|pwd)\w*>(?P<secret>[^<\r\n]{1,512})</`),
+			// <Value>P@ss</Value> inside a <Password> element
+			regexp.MustCompile(`(?i)<(?:\w+:)?\w*(?:password|passwd|pwd)\w*>\s*<Value>(?P<secret>[^<\r\n]{1,512})</Value>`),
+		},
+	},
+	{
+		Name:     "password-assignment",
+		Keywords: []string{"pass", "pwd", "secret", "token", "apikey", "api_key"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)(?:^|[^\w])\$?[\w.-]*(?:password|passwd|pwd|secret|token|apikey|api_key)[\w-]*"?\s*(?:[:=]|-eq)\s*(?:"(?P<secret>[^"\r\n]{4,})"|'(?P<secret>[^'\r\n]{4,})'|(?P<secret>[^\s"';,<>()\[\]{}$%]{6,}))`)},
+		// Placeholders, booleans and variable names have little entropy
+		MinEntropy: 2.5,
+	},
+}
@@ -0,0 +1,251 @@
+package analyze
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxScanSize caps the size of the files scanned, larger ones are installers and archives
+const maxScanSize = 32 << 20
+
+// maxPreview caps the length of a preview, in characters
+const maxPreview = 200
+
+// cmdlet matches a PowerShell cmdlet name, assigned to a password variable when prompting for it
+var cmdlet = regexp.MustCompile(`^(?:Get|Read|ConvertTo|ConvertFrom|New|Import)-[A-Z]\w+$`)
+
+// Scanner runs rules over files, it is safe for concurrent use
+type Scanner struct {
+	rules []Rule
+}
+
+// NewScanner returns a Scanner with rules, DefaultRules if there are none
+func NewScanner(rules ...Rule) *Scanner {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	return &Scanner{rules: rules}
+}
+
+// ScanFile returns the findings in the file at path. Binary and very large files are skipped.
+func (s *Scanner) ScanFile(path string) ([]Finding, error) {
+	doc, err := ReadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.ScanDocument(doc), nil
+}
+
+// ScanDocument returns the findings in doc. Binary and very large files are skipped.
+func (s *Scanner) ScanDocument(doc *Document) []Finding {
+	text, ok := doc.decoded()
+	if !ok {
+		return nil
+	}
+	findings := s.scanText(text)
+	for i := range findings {
+		findings[i].File = doc.Path
+	}
+	return findings
+}
+
+// Scan returns the findings in data, which is decoded from UTF-16 if it has to be
+func (s *Scanner) Scan(data []byte) []Finding {
+	text, ok := decodeText(data)
+	if !ok {
+		return nil
+	}
+	return s.scanText(text)
+}
+
+// scanText returns the findings in text
+func (s *Scanner) scanText(text string) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		lower := strings.ToLower(line)
+		// A secret is only reported once per line, by the most specific rule
+		reported := make(map[string]bool)
+		for _, rule := range s.rules {
+			if !containsAny(lower, rule.Keywords) {
+				continue
+			}
+			for _, pattern := range rule.Patterns {
+				for _, match := range pattern.FindAllStringSubmatchIndex(line, -1) {
+					finding, secret, ok := rule.finding(pattern.SubexpNames(), line, match)
+					if !ok || reported[secret] {
+						continue
+					}
+					reported[secret] = true
+					finding.Line = i + 1
+					findings = append(findings, finding)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// finding returns the finding for match in line, with its secret, or false if the secret looks like a placeholder
+func (r Rule) finding(names []string, line string, match []int) (Finding, string, bool) {
+	group := func(name string) (int, int) {
+		for i, n := range names {
+			if n == name && match[2*i] >= 0 && match[2*i+1] > match[2*i] {
+				return match[2*i], match[2*i+1]
+			}
+		}
+		return -1, -1
+	}
+
+	finding := Finding{Rule: r.Name}
+	if start, end := group("user"); start >= 0 {
+		finding.User = strings.Trim(line[start:end], `"'`)
+	}
+	start, end := group("secret")
+	if start < 0 {
+		// The whole match is the finding, i.e. a private key header
+		finding.Preview = preview(line, match[0], match[0], match[0])
+		return finding, line[match[0]:match[1]], true
+	}
+	secret := line[start:end]
+	if placeholder(secret) || r.MinEntropy > 0 && entropy(secret) < r.MinEntropy {
+		return finding, secret, false
+	}
+	finding.Preview = preview(line, match[0], start, end)
+	return finding, secret, true
+}
+
+// placeholder returns whether secret is a prompt, variable or placeholder rather than a real secret
+func placeholder(secret string) bool {
+	s := strings.TrimSpace(secret)
+	switch {
+	case s == "", strings.Trim(s, "*xX.") == "":
+		return true
+	// Sysprep replaces the passwords of answer files it used
+	case s == "*SENSITIVE*DATA*DELETED*":
+		return true
+	// %PASSWORD%, $(Password), ${password}, <password>, [password], {{password}}
+	case strings.HasPrefix(s, "%") && strings.HasSuffix(s, "%"),
+		strings.HasPrefix(s, "$(") || strings.HasPrefix(s, "${"),
+		strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">"),
+		strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"),
+		strings.HasPrefix(s, "{{") && strings.HasSuffix(s, "}}"):
+		return true
+	}
+	// $password = Read-Host -AsSecureString
+	if cmdlet.MatchString(s) {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "null", "none", "password", "yourpassword", "changeme", "secret", "required", "optional":
+		return true
+	}
+	return false
+}
+
+// preview returns the text of line from a little before start, with the secret from secretStart to
+// secretEnd redacted, if there is one, and the result capped at maxPreview characters
+func preview(line string, start, secretStart, secretEnd int) string {
+	from := max(start-40, 0)
+	for from > 0 && !utf8.RuneStart(line[from]) {
+		from--
+	}
+	text := line[from:]
+	if secretEnd > secretStart {
+		text = line[from:secretStart] + redact(line[secretStart:secretEnd]) + line[secretEnd:]
+	}
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxPreview {
+		text = string([]rune(text)[:maxPreview]) + "..."
+	}
+	return text
+}
+
+// redact keeps the first two characters of secret, enough to tell secrets apart without revealing them
+func redact(secret string) string {
+	runes := []rune(secret)
+	if len(runes) <= 4 {
+		return "****"
+	}
+	return string(runes[:2]) + "****"
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	var h float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// readFile returns the content of the file at path, or nothing if it is over maxScanSize
+func readFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxScanSize {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(s, keyword) {
+			return true
+		}
+	}
+	return len(keywords) == 0
+}
+
+// decodeText returns data as text, decoding UTF-16 (common in Windows .reg, .xml and .ps1
+// files), or false if it is binary
+func decodeText(data []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), true
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], binary.LittleEndian), true
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], binary.BigEndian), true
+	}
+
+	sample := data[:min(len(data), 8192)]
+	if bytes.IndexByte(sample, 0) < 0 {
+		return string(data), true
+	}
+	// UTF-16LE without a BOM has a zero in most odd bytes of ASCII text
+	zeros := 0
+	for i := 1; i < len(sample); i += 2 {
+		if sample[i] == 0 {
+			zeros++
+		}
+	}
+	if len(sample) >= 2 && zeros*10 >= len(sample)/2*8 {
+		return decodeUTF16(data, binary.LittleEndian), true
+	}
+	return "", false
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
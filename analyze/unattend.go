@@ -0,0 +1,88 @@
+package analyze
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+)
+
+// unattendCredentials returns the credentials of an unattend.xml or autounattend.xml answer file: the
+// administrator and local account passwords, the auto logon account, and the accounts used to join the
+// domain and log on to Windows Deployment Services
+func unattendCredentials(root *xmlNode) []Credential {
+	if !root.is("unattend") {
+		return nil
+	}
+
+	var credentials []Credential
+	add := func(credential Credential) {
+		if credential.Secret == "" || placeholder(credential.Secret) {
+			return
+		}
+		credential.User, credential.Domain = splitAccount(credential.User, credential.Domain)
+		for _, c := range credentials {
+			if c == credential {
+				return
+			}
+		}
+		credentials = append(credentials, credential)
+	}
+
+	root.walk(func(n *xmlNode) {
+		switch {
+		case n.is("AdministratorPassword"):
+			add(Credential{User: "Administrator", Secret: unattendPassword(n), Source: "unattend:AdministratorPassword"})
+		case n.is("LocalAccount"):
+			add(Credential{User: n.childText("Name"), Secret: unattendPassword(n.child("Password")), Source: "unattend:LocalAccount"})
+		case n.is("AutoLogon"):
+			add(Credential{User: n.childText("Username"), Domain: n.childText("Domain"), Secret: unattendPassword(n.child("Password")), Source: "unattend:AutoLogon"})
+		case n.is("Credentials") && n.Parent != nil && n.Parent.is("Identification"):
+			// The domain of the account defaults to the domain joined
+			domain := n.childText("Domain")
+			if domain == "" {
+				domain = n.Parent.childText("JoinDomain")
+			}
+			add(Credential{User: n.childText("Username"), Domain: domain, Secret: unattendPassword(n.child("Password")), Source: "unattend:DomainJoin"})
+		case n.is("Credentials") && n.Parent != nil && n.Parent.is("Login"):
+			add(Credential{User: n.childText("Username"), Domain: n.childText("Domain"), Secret: unattendPassword(n.child("Password")), Source: "unattend:WDSLogin"})
+		case n.is("Credentials"):
+			add(Credential{User: n.childText("Username"), Domain: n.childText("Domain"), Secret: unattendPassword(n.child("Password")), Source: "unattend:Credentials"})
+		case n.is("MachinePassword") && n.Parent != nil && n.Parent.is("Identification"):
+			// The password of a computer account created in advance for an unsecure join
+			add(Credential{Domain: n.Parent.childText("JoinDomain"), Secret: unattendPassword(n), Source: "unattend:MachinePassword"})
+		}
+	})
+	return credentials
+}
+
+// unattendPassword returns the password of a password element, which is either its text or a Value
+// child. Passwords hidden by Windows System Image Manager (PlainText false) are decoded.
+func unattendPassword(n *xmlNode) string {
+	if n == nil {
+		return ""
+	}
+	value := n.Text
+	if v := n.child("Value"); v != nil {
+		value = v.Text
+	}
+	// Not every tool writes PlainText, so any value encoded that way is decoded
+	if decoded, ok := decodeUnattendPassword(value, n.Name); ok {
+		return decoded
+	}
+	return value
+}
+
+// decodeUnattendPassword reverses the encoding of hidden passwords in answer files: the password
+// followed by the name of its element (i.e. "Password" or "AdministratorPassword"), as UTF-16LE and
+// then base64. It returns false if value is not encoded that way.
+func decodeUnattendPassword(value, element string) (string, bool) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(raw) == 0 || len(raw)%2 != 0 {
+		return "", false
+	}
+	decoded := decodeUTF16(raw, binary.LittleEndian)
+	if !strings.HasSuffix(decoded, element) {
+		return "", false
+	}
+	return strings.TrimSuffix(decoded, element), true
+}
@@ -0,0 +1,91 @@
+package analyze
+
+import (
+	"slices"
+	"testing"
+)
+
+// unattendXML is an answer file as Windows System Image Manager writes it, with hidden passwords
+const unattendXML = `<?xml version="1.0" encoding="utf-8"?>
+<unattend xmlns="urn:schemas-microsoft-com:unattend">
+	<settings pass="specialize">
+		<component name="Microsoft-Windows-UnattendedJoin" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+			<Identification>
+				<Credentials>
+					<Domain>CORP</Domain>
+					<Password>Str0ng!Join</Password>
+					<Username>svc_join</Username>
+				</Credentials>
+				<JoinDomain>corp.local</JoinDomain>
+			</Identification>
+		</component>
+	</settings>
+	<settings pass="oobeSystem">
+		<component name="Microsoft-Windows-Shell-Setup" processorArchitecture="amd64" publicKeyToken="31bf3856ad364e35" language="neutral" versionScope="nonSxS">
+			<AutoLogon>
+				<Password>
+					<Value>UwAzAGMAcgAzAHQAIQBQAGEAcwBzAHcAbwByAGQA</Value>
+					<PlainText>false</PlainText>
+				</Password>
+				<Enabled>true</Enabled>
+				<Username>CORP\deploy</Username>
+			</AutoLogon>
+			<UserAccounts>
+				<AdministratorPassword>
+					<Value>QQBkAG0AMQBuACMAMgAwADIANABBAGQAbQBpAG4AaQBzAHQAcgBhAHQAbwByAFAAYQBzAHMAdwBvAHIAZAA=</Value>
+					<PlainText>false</PlainText>
+				</AdministratorPassword>
+				<LocalAccounts>
+					<LocalAccount>
+						<Password>
+							<Value>*SENSITIVE*DATA*DELETED*</Value>
+							<PlainText>false</PlainText>
+						</Password>
+						<Name>support</Name>
+					</LocalAccount>
+				</LocalAccounts>
+			</UserAccounts>
+		</component>
+	</settings>
+</unattend>
+`
+
+func TestDecodeUnattendPassword(t *testing.T) {
+	tests := []struct {
+		value, element string
+		want           string
+		ok             bool
+	}{
+		{"UwAzAGMAcgAzAHQAIQBQAGEAcwBzAHcAbwByAGQA", "Password", "S3cr3t!", true},
+		{" UwAzAGMAcgAzAHQAIQBQAGEAcwBzAHcAbwByAGQA\n", "Password", "S3cr3t!", true},
+		{"QQBkAG0AMQBuACMAMgAwADIANABBAGQAbQBpAG4AaQBzAHQAcgBhAHQAbwByAFAAYQBzAHMAdwBvAHIAZAA=", "AdministratorPassword", "Adm1n#2024", true},
+		// The suffix is the name of the element the password is in
+		{"UwAzAGMAcgAzAHQAIQBQAGEAcwBzAHcAbwByAGQA", "AdministratorPassword", "", false},
+		// Plain text passwords that happen to be valid base64
+		{"Passw0rd", "Password", "", false},
+		{"Str0ng!Join", "Password", "", false},
+		{"", "Password", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := decodeUnattendPassword(tt.value, tt.element)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("decodeUnattendPassword(%q, %q) = %q, %v, want %q, %v", tt.value, tt.element, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUnattendCredentials(t *testing.T) {
+	for name, data := range map[string][]byte{"utf-8": []byte(unattendXML), "utf-16": utf16LE(unattendXML)} {
+		t.Run(name, func(t *testing.T) {
+			got := NewDocument("unattend.xml", data).Credentials()
+			want := []Credential{
+				{File: "unattend.xml", User: "svc_join", Domain: "CORP", Secret: "Str0ng!Join", Source: "unattend:DomainJoin"},
+				{File: "unattend.xml", User: "deploy", Domain: "CORP", Secret: "S3cr3t!", Source: "unattend:AutoLogon"},
+				{File: "unattend.xml", User: "Administrator", Secret: "Adm1n#2024", Source: "unattend:AdministratorPassword"},
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("ExtractCredentials() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
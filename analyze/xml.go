@@ -0,0 +1,106 @@
+package analyze
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// xmlNode is an element of an XML document, with its namespace dropped
+type xmlNode struct {
+	Name     string
+	Attrs    map[string]string
+	Text     string
+	Children []*xmlNode
+	Parent   *xmlNode
+}
+
+// parseXML returns the root element of the XML document in text, already decoded from UTF-16
+func parseXML(text string) (*xmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = false
+	// The text is already decoded, whatever the declaration says
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var root, current *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if root != nil {
+				// Keep what was parsed of a truncated or malformed document
+				return root, nil
+			}
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: t.Name.Local, Attrs: make(map[string]string, len(t.Attr)), Parent: current}
+			for _, attr := range t.Attr {
+				node.Attrs[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			if current == nil {
+				if root != nil {
+					return root, nil
+				}
+				root = node
+			} else {
+				current.Children = append(current.Children, node)
+			}
+			current = node
+		case xml.EndElement:
+			if current != nil {
+				current.Text = strings.TrimSpace(current.Text)
+				current = current.Parent
+			}
+		case xml.CharData:
+			if current != nil {
+				current.Text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return root, nil
+}
+
+// is returns whether the element is named name, ignoring case
+func (n *xmlNode) is(name string) bool {
+	return strings.EqualFold(n.Name, name)
+}
+
+// child returns the first child element named name, ignoring case, or nil
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, child := range n.Children {
+		if child.is(name) {
+			return child
+		}
+	}
+	return nil
+}
+
+// childText returns the text of the first child element named name, "" if there is none
+func (n *xmlNode) childText(name string) string {
+	if child := n.child(name); child != nil {
+		return child.Text
+	}
+	return ""
+}
+
+// attr returns the attribute named name, ignoring case
+func (n *xmlNode) attr(name string) string {
+	return n.Attrs[strings.ToLower(name)]
+}
+
+// walk calls fn for the element and every element below it, in document order
+func (n *xmlNode) walk(fn func(*xmlNode)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.walk(fn)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"sccm-http-looter/looter"
+)
+
+// runDiscover is the discover subcommand: it probes hosts for the DP virtual directories and writes
+// the DPs it finds to a targets file for -targets
+func runDiscover(args []string) {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s discover [options] [CIDR|IP|host ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	// A sweep only needs status codes and the NTLM challenge, credentials would be sprayed at every host
+	clientArgs := addAnonymousClientFlags(fs)
+	hostsPath := fs.String("hosts", "", "Path to a file of CIDRs, IP addresses or host names to probe, one per line ('#' starts a comment)")
+	nmapPath := fs.String("nmap", "", "Path to an nmap XML report (-oX), the open -ports and HTTP ports of its hosts are probed")
+	ports := fs.String("ports", "80,443", "Comma-separated ports to probe on each host")
+	httpsPorts := fs.String("https-ports", "443,8443,8531", "Comma-separated ports that use HTTPS")
+	threads := fs.Int("threads", 32, "Maximum number of hosts and ports probed at once")
+	rate := fs.Float64("rate", 0, "Maximum requests per second across all hosts (0 for no limit)")
+	bandwidth := fs.String("bandwidth", "0", "Maximum bytes per second downloaded across all hosts, with an optional K, M or G suffix (0 for no limit)")
+	targetsPath := fs.String("targets-out", "targets.txt", "Targets file the DPs found are written to, for -targets")
+	verbose := fs.Bool("verbose", false, "print debug/error statements")
+	fs.Parse(args)
+
+	slog.Info("SCCM HTTP Looter by Bad Sector Labs (@badsectorlabs)")
+
+	if *verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	portList := splitList(*ports)
+	httpsPortList := splitList(*httpsPorts)
+	bytesPerSecond, err := parseByteRate(*bandwidth)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Invalid -bandwidth value: %s", *bandwidth))
+		os.Exit(1)
+	}
+
+	candidates, err := discoveryCandidates(fs.Args(), *hostsPath, *nmapPath, portList, httpsPortList)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if len(candidates) == 0 {
+		slog.Error("Nothing to probe, give CIDRs, IP addresses or host names, -hosts or -nmap")
+		os.Exit(1)
+	}
+
+	clientConfig, err := clientArgs.config(nil)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	client, err := looter.NewHTTPClient(clientConfig)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Unable to create HTTP client: %v", err))
+		os.Exit(1)
+	}
+	opts := looter.Options{
+		GlobalRate: looter.NewRateLimit(*rate, bytesPerSecond, false),
+		// Most candidates are not DPs, there is nothing to retry
+		Retry: looter.RetryPolicy{MaxAttempts: 1},
+	}
+
+	slog.Info(fmt.Sprintf("Probing %d hosts and ports for DPs...", len(candidates)))
+	detections := make([]looter.Detection, len(candidates))
+	slots := make(chan struct{}, max(*threads, 1))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		l, err := looter.New(candidate.BaseURL(), client, opts)
+		if err != nil {
+			detections[i] = looter.Detection{Target: candidate.BaseURL(), Error: err.Error()}
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, l *looter.Looter) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			detections[i] = l.Detect()
+			if detections[i].DP {
+				slog.Info(fmt.Sprintf("Found a DP at %s", l.BaseURL))
+			}
+		}(i, l)
+	}
+	wg.Wait()
+
+	var found []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tSMS_DP_SMSPKG$\tSMS_DP_SMSSIG$\tSERVER\tDOMAIN")
+	for _, detection := range detections {
+		if detection.Error != "" {
+			slog.Debug(fmt.Sprintf("%s: %s", detection.Target, detection.Error))
+		}
+		if !detection.DP {
+			continue
+		}
+		found = append(found, detection.Target)
+		domain := "-"
+		if detection.NTLM != nil {
+			domain = detection.NTLM.DNSDomainName
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", detection.Target, detection.PackageStatus, detection.SignatureStatus, detection.Server, domain)
+	}
+	w.Flush()
+
+	if err := writeTargets(*targetsPath, found); err != nil {
+		slog.Error(fmt.Sprintf("Error writing targets file: %v", err))
+		os.Exit(1)
+	}
+	slog.Info(fmt.Sprintf("Found %d DPs, saved to %s (use with -targets %s)", len(found), *targetsPath, *targetsPath))
+}
+
+// discoveryCandidates returns every host and port to probe, from hosts (CIDRs, IP addresses or host
+// names), the file at hostsPath and the nmap XML report at nmapPath
+func discoveryCandidates(hosts []string, hostsPath, nmapPath string, ports, httpsPorts []string) ([]looter.Candidate, error) {
+	if hostsPath != "" {
+		file, err := os.Open(hostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read file: %s", hostsPath)
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			if line = strings.TrimSpace(line); line != "" {
+				hosts = append(hosts, line)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var candidates []looter.Candidate
+	for _, spec := range hosts {
+		expanded, err := looter.ExpandHosts(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range expanded {
+			for _, port := range ports {
+				scheme := "http"
+				if slices.Contains(httpsPorts, port) {
+					scheme = "https"
+				}
+				candidates = append(candidates, looter.Candidate{Host: host, Port: port, Scheme: scheme})
+			}
+		}
+	}
+
+	if nmapPath != "" {
+		file, err := os.Open(nmapPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read file: %s", nmapPath)
+		}
+		fromNmap, err := looter.ParseNmapXML(file, ports, httpsPorts)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, fromNmap...)
+	}
+
+	// The same host and port can come from several sources
+	seen := make(map[string]bool)
+	unique := candidates[:0]
+	for _, candidate := range candidates {
+		if !seen[candidate.BaseURL()] {
+			seen[candidate.BaseURL()] = true
+			unique = append(unique, candidate)
+		}
+	}
+	return unique, nil
+}
+
+// writeTargets writes the base URL of every DP found to a targets file
+func writeTargets(filePath string, targets []string) error {
+	var b strings.Builder
+	b.WriteString("# DPs found by sccm-http-looter discover\n")
+	for _, target := range targets {
+		b.WriteString(target + "\n")
+	}
+	return os.WriteFile(filePath, []byte(b.String()), 0644)
+}
+
+// splitList splits a comma-separated list, dropping blank items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"sccm-http-looter/looter"
+)
+
+// targetFlags are the command line options that select the DPs to work on
+type targetFlags struct {
+	protocol    *string
+	server      *string
+	port        *string
+	targetsPath *string
+}
+
+func addTargetFlags(fs *flag.FlagSet) *targetFlags {
+	return &targetFlags{
+		protocol:    fs.String("protocol", "http", "The protocol (http or https)"),
+		server:      fs.String("server", "127.0.0.1", "The IP address or hostname of the SCCM DP"),
+		port:        fs.String("port", "80", "The port of the HTTP(S) server on the SCCM DP"),
+		targetsPath: fs.String("targets", "", "Path to a file of DPs to loot, one URL or host[:port] per line ('#' starts a comment). Each DP is saved to its own subdirectory of -output"),
+	}
+}
+
+// targets returns the base URL of every DP, from -targets or from -protocol, -server and -port
+func (f *targetFlags) targets() ([]string, error) {
+	if *f.targetsPath == "" {
+		return []string{fmt.Sprintf("%s://%s", *f.protocol, net.JoinHostPort(*f.server, *f.port))}, nil
+	}
+	file, err := os.Open(*f.targetsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file: %s", *f.targetsPath)
+	}
+	defer file.Close()
+	targets, err := looter.ParseTargets(file, *f.protocol, *f.port)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse targets file %s: %w", *f.targetsPath, err)
+	}
+	return targets, nil
+}
+
+// clientFlags are the command line options of the HTTP client. The credential options are nil for
+// commands that do not take them.
+type clientFlags struct {
+	userAgent *string
+	timeout   *string
+	validate  *bool
+	proxy     *string
+	username  *string
+	password  *string
+	domain    *string
+	ntHash    *string
+}
+
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	f := addAnonymousClientFlags(fs)
+	f.username = fs.String("username", "", "Username for DPs that require Windows authentication (DOMAIN\\user and user@domain are accepted)")
+	f.password = fs.String("password", "", "Password for -username")
+	f.domain = fs.String("domain", "", "Domain for -username")
+	f.ntHash = fs.String("nthash", "", "NT hash for -username, used instead of -password (pass-the-hash)")
+	return f
+}
+
+// addAnonymousClientFlags adds the client options without the credentials, for commands that must
+// never authenticate
+func addAnonymousClientFlags(fs *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		userAgent: fs.String("useragent", "sccm-http-looter", "User agent to use for all requests"),
+		timeout:   fs.String("timeout", "10s", "HTTP timeout value, use a number + 'ms', 's', 'm', or 'h' for values"),
+		validate:  fs.Bool("validate", false, "Validate HTTPS certificates"),
+		proxy:     fs.String("proxy", "", "Proxy for all requests: http://[user:pass@]host:port, socks5://[user:pass@]host:port (names resolved locally) or socks5h://... (names resolved by the proxy)"),
+	}
+}
+
+// config returns the client configuration, with the credentials for targets if -username is set
+func (f *clientFlags) config(targets []string) (looter.ClientConfig, error) {
+	timeout, err := time.ParseDuration(*f.timeout)
+	if err != nil {
+		return looter.ClientConfig{}, fmt.Errorf("unable to parse HTTP Timeout value: %s", *f.timeout)
+	}
+	cfg := looter.ClientConfig{
+		UserAgent:  *f.userAgent,
+		SkipVerify: !*f.validate,
+		Timeout:    timeout,
+		Proxy:      *f.proxy,
+	}
+	if f.username != nil && *f.username != "" {
+		cfg.Credentials = &looter.Credentials{
+			Username: *f.username,
+			Password: *f.password,
+			Domain:   *f.domain,
+			NTHash:   *f.ntHash,
+			Targets:  targets,
+		}
+	}
+	return cfg, nil
+}
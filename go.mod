@@ -3,6 +3,7 @@ module sccm-http-looter
 go 1.22
 
 require (
+	golang.org/x/crypto v0.27.0
 	golang.org/x/net v0.29.0
 	gopkg.in/ini.v1 v1.67.0
 )
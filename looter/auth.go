@@ -0,0 +1,293 @@
+package looter
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"sccm-http-looter/ntlm"
+)
+
+// Credentials are the domain credentials used when a DP does not allow anonymous access
+type Credentials struct {
+	// Username may include the domain as DOMAIN\user or user@domain
+	Username string
+	Password string
+	Domain   string
+	// NTHash is the hex encoded NT hash of the password, used instead of Password to pass-the-hash
+	NTHash string
+	// Targets are the base URLs of the DPs the credentials are sent to. Other hosts, i.e. those of a
+	// redirect or of a link in a listing, are only accessed anonymously.
+	Targets []string
+}
+
+// ntlmTransport is an http.RoundTripper that answers the NTLM (or Negotiate) authentication requests
+// of the target DPs
+type ntlmTransport struct {
+	base   *http.Transport
+	domain string
+	user   string
+	ntHash []byte
+	// targets are the origins (scheme://host:port) credentials are sent to
+	targets map[string]bool
+	// schemes are the authentication schemes each target asked for, by origin, until its first 401
+	schemes sync.Map
+}
+
+func newNTLMTransport(base *http.Transport, creds *Credentials) (*ntlmTransport, error) {
+	t := &ntlmTransport{
+		base:    base,
+		domain:  creds.Domain,
+		user:    creds.Username,
+		targets: make(map[string]bool, len(creds.Targets)),
+	}
+	for _, target := range creds.Targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target: %s", target)
+		}
+		t.targets[origin(u)] = true
+	}
+	if domain, user, found := strings.Cut(t.user, `\`); found && t.domain == "" {
+		t.domain, t.user = domain, user
+	} else if user, domain, found := strings.Cut(t.user, "@"); found && t.domain == "" {
+		t.domain, t.user = domain, user
+	}
+
+	if creds.NTHash != "" {
+		// Accept LM:NT pairs as dumped by secretsdump
+		_, nthash, _ := strings.Cut(creds.NTHash, ":")
+		if nthash == "" {
+			nthash = creds.NTHash
+		}
+		hash, err := hex.DecodeString(nthash)
+		if err != nil || len(hash) != 16 {
+			return nil, fmt.Errorf("invalid NT hash: %s", creds.NTHash)
+		}
+		t.ntHash = hash
+	} else {
+		t.ntHash = ntlm.NTHash(creds.Password)
+	}
+	return t, nil
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" || !t.authenticates(req) {
+		// The caller does its own authentication (i.e. ProbeNTLM), or the host is not a target
+		return t.base.RoundTrip(req)
+	}
+	target := origin(req.URL)
+	scheme := ""
+	if value, ok := t.schemes.Load(target); ok {
+		scheme = value.(string)
+	}
+	if scheme == "" {
+		// Try anonymously until the DP asks for credentials
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		scheme = authScheme(resp.Header.Values("WWW-Authenticate"))
+		if scheme == "" {
+			// Nothing we can answer, i.e. Basic or Kerberos only
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		t.schemes.Store(target, scheme)
+
+		if req.Body != nil && req.GetBody == nil {
+			return nil, errors.New("cannot replay request body for NTLM authentication")
+		}
+	}
+	return t.handshake(req, scheme)
+}
+
+// authenticates returns whether credentials are sent with req: only to the targets, and not after a
+// redirect from another host
+func (t *ntlmTransport) authenticates(req *http.Request) bool {
+	target := origin(req.URL)
+	if !t.targets[target] {
+		return false
+	}
+	for r := req; r.Response != nil && r.Response.Request != nil; r = r.Response.Request {
+		if origin(r.Response.Request.URL) != target {
+			return false
+		}
+	}
+	return true
+}
+
+// origin returns the scheme, host and port of u, with the default port of the scheme if it has none
+func origin(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(u.Scheme, "https") {
+			port = "443"
+		}
+	}
+	return strings.ToLower(u.Scheme) + "://" + net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// handshake sends req with the NTLM negotiate, challenge and authenticate exchange. NTLM authenticates
+// the connection rather than the request, so every message goes over a dedicated connection.
+func (t *ntlmTransport) handshake(req *http.Request, scheme string) (*http.Response, error) {
+	conn := t.base.Clone()
+	conn.DisableKeepAlives = false
+	conn.MaxConnsPerHost = 1
+
+	negotiate, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	negotiate.Header.Set("Authorization", scheme+" "+base64.StdEncoding.EncodeToString(ntlm.NegotiateMessage()))
+	resp, err := conn.RoundTrip(negotiate)
+	if err != nil {
+		conn.CloseIdleConnections()
+		return nil, err
+	}
+	token := challengeToken(resp.Header.Values("WWW-Authenticate"), scheme)
+	if resp.StatusCode != http.StatusUnauthorized || token == nil {
+		return closeIdleOnClose(resp, conn), nil
+	}
+	// Read the whole body so the connection can be reused for the authenticate message
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	challenge, err := ntlm.ParseChallengeMessage(token)
+	if err != nil {
+		conn.CloseIdleConnections()
+		return nil, err
+	}
+	authenticateMessage, err := ntlm.AuthenticateMessage(challenge, t.domain, t.user, t.ntHash)
+	if err != nil {
+		conn.CloseIdleConnections()
+		return nil, err
+	}
+	authenticate, err := cloneRequest(req)
+	if err != nil {
+		conn.CloseIdleConnections()
+		return nil, err
+	}
+	authenticate.Header.Set("Authorization", scheme+" "+base64.StdEncoding.EncodeToString(authenticateMessage))
+	resp, err = conn.RoundTrip(authenticate)
+	if err != nil {
+		conn.CloseIdleConnections()
+		return nil, err
+	}
+	return closeIdleOnClose(resp, conn), nil
+}
+
+// authScheme returns the scheme to answer with NTLM, preferring NTLM over Negotiate
+func authScheme(wwwAuthenticate []string) string {
+	scheme := ""
+	for _, header := range wwwAuthenticate {
+		name, _, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if strings.EqualFold(name, "NTLM") {
+			return "NTLM"
+		}
+		if strings.EqualFold(name, "Negotiate") {
+			scheme = "Negotiate"
+		}
+	}
+	return scheme
+}
+
+// challengeToken returns the decoded NTLM message in the WWW-Authenticate header for scheme, if any
+func challengeToken(wwwAuthenticate []string, scheme string) []byte {
+	for _, header := range wwwAuthenticate {
+		name, value, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(name, scheme) || value == "" {
+			continue
+		}
+		token, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err == nil {
+			return token
+		}
+	}
+	return nil
+}
+
+// cloneRequest returns a copy of req that can be sent again, including its body
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// closeIdleOnClose closes the connections of transport once the response body is closed
+func closeIdleOnClose(resp *http.Response, transport *http.Transport) *http.Response {
+	resp.Body = &closeIdleBody{ReadCloser: resp.Body, transport: transport}
+	return resp
+}
+
+type closeIdleBody struct {
+	io.ReadCloser
+	transport *http.Transport
+}
+
+func (b *closeIdleBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.transport.CloseIdleConnections()
+	return err
+}
+
+// ProbeNTLM sends an NTLM negotiate message for the Datalib and decodes the challenge the DP answers
+// with, which names its host and domain and gives its OS version. The result is kept for the Report.
+func (l *Looter) ProbeNTLM() (*ntlm.ServerInfo, error) {
+	return l.probeNTLM(fmt.Sprintf("%s/SMS_DP_SMSPKG$/Datalib", l.BaseURL))
+}
+
+// probeNTLM is ProbeNTLM for url, trying the NTLM then the Negotiate scheme
+func (l *Looter) probeNTLM(url string) (*ntlm.ServerInfo, error) {
+	l.ntlmProbed.Store(true)
+	for _, scheme := range []string{"NTLM", "Negotiate"} {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", scheme+" "+base64.StdEncoding.EncodeToString(ntlm.NegotiateMessage()))
+		response, err := l.send(l.Client, request)
+		if err != nil {
+			return nil, err
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+
+		token := challengeToken(response.Header.Values("WWW-Authenticate"), scheme)
+		if token == nil {
+			continue
+		}
+		challenge, err := ntlm.ParseChallengeMessage(token)
+		if err != nil {
+			return nil, err
+		}
+		info := challenge.ServerInfo()
+		l.stats.setNTLM(info)
+		slog.Info(fmt.Sprintf("%s: NTLM challenge from %s\\%s (%s) in domain %s, OS version %s", l.BaseURL, info.NetBIOSDomainName, info.NetBIOSComputerName, info.DNSComputerName, info.DNSDomainName, info.OSVersion))
+		return info, nil
+	}
+	return nil, errors.New("no NTLM challenge in the response")
+}
+
+// NTLMInfo returns what the DP disclosed in its NTLM challenge, nil if it was not probed
+func (l *Looter) NTLMInfo() *ntlm.ServerInfo {
+	l.stats.mu.Lock()
+	defer l.stats.mu.Unlock()
+	return l.stats.ntlm
+}
@@ -0,0 +1,331 @@
+package looter
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"sccm-http-looter/ntlm"
+)
+
+const (
+	testUser     = "svc_sccm"
+	testDomain   = "CORP"
+	testPassword = "Summer2024!"
+)
+
+// ntlmServer is the server side of the NTLM handshake, like IIS with Windows authentication: it
+// answers 401 until a connection authenticates with the NTLMv2 response of its account
+type ntlmServer struct {
+	user, domain string
+	ntHash       []byte
+	// scheme is the scheme offered in WWW-Authenticate, NTLM or Negotiate
+	scheme string
+
+	mu sync.Mutex
+	// challenges are the server challenges sent, by connection
+	challenges map[string][8]byte
+	// negotiates counts the negotiate messages received
+	negotiates atomic.Int32
+	// handshakes counts the authenticate messages accepted
+	handshakes atomic.Int32
+}
+
+func newNTLMServer(scheme string) *ntlmServer {
+	return &ntlmServer{
+		user:       testUser,
+		domain:     testDomain,
+		ntHash:     ntlm.NTHash(testPassword),
+		scheme:     scheme,
+		challenges: make(map[string][8]byte),
+	}
+}
+
+// wrap answers the NTLM handshake, then serves next to the authenticated requests
+func (s *ntlmServer) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, value, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		token, err := base64.StdEncoding.DecodeString(value)
+		if scheme != s.scheme || err != nil || len(token) < 12 {
+			// IIS offers NTLM after Negotiate, unless only the Negotiate provider is enabled
+			w.Header().Add("WWW-Authenticate", "Negotiate")
+			if s.scheme == "NTLM" {
+				w.Header().Add("WWW-Authenticate", "NTLM")
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch binary.LittleEndian.Uint32(token[8:]) {
+		case 1:
+			s.negotiates.Add(1)
+			var challenge [8]byte
+			rand.Read(challenge[:])
+			s.mu.Lock()
+			s.challenges[r.RemoteAddr] = challenge
+			s.mu.Unlock()
+			w.Header().Set("WWW-Authenticate", s.scheme+" "+base64.StdEncoding.EncodeToString(challengeMessage(challenge)))
+			w.WriteHeader(http.StatusUnauthorized)
+		case 3:
+			s.mu.Lock()
+			challenge, ok := s.challenges[r.RemoteAddr]
+			delete(s.challenges, r.RemoteAddr)
+			s.mu.Unlock()
+			// NTLM authenticates the connection the challenge was sent on
+			if !ok || !s.verify(challenge, token) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			s.handshakes.Add(1)
+			next.ServeHTTP(w, r)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+}
+
+// verify checks the account and NTLMv2 response of an authenticate message
+func (s *ntlmServer) verify(challenge [8]byte, msg []byte) bool {
+	field := func(pos int) []byte {
+		length := int(binary.LittleEndian.Uint16(msg[pos:]))
+		offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+		if offset+length > len(msg) {
+			return nil
+		}
+		return msg[offset : offset+length]
+	}
+	if len(msg) < 64 {
+		return false
+	}
+	ntResponse, domain, user := field(20), fromUTF16(field(28)), fromUTF16(field(36))
+	if len(ntResponse) <= 16 || !strings.EqualFold(user, s.user) || !strings.EqualFold(domain, s.domain) {
+		return false
+	}
+	key := hmacMD5(s.ntHash, toUTF16(strings.ToUpper(user)+domain))
+	return hmac.Equal(ntResponse[:16], hmacMD5(key, append(challenge[:], ntResponse[16:]...)))
+}
+
+// challengeMessage returns a challenge message with challenge and the names of the server
+func challengeMessage(challenge [8]byte) []byte {
+	var targetInfo []byte
+	for _, pair := range []struct {
+		id    uint16
+		value []byte
+	}{{2, toUTF16(testDomain)}, {1, toUTF16("SCCM01")}, {0, nil}} {
+		targetInfo = binary.LittleEndian.AppendUint16(targetInfo, pair.id)
+		targetInfo = binary.LittleEndian.AppendUint16(targetInfo, uint16(len(pair.value)))
+		targetInfo = append(targetInfo, pair.value...)
+	}
+
+	msg := make([]byte, 48)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	// Unicode, NTLM, extended session security and target info
+	binary.LittleEndian.PutUint32(msg[20:], 0x00888201)
+	copy(msg[24:], challenge[:])
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return append(msg, targetInfo...)
+}
+
+func hmacMD5(key, data []byte) []byte {
+	mac := hmac.New(md5.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func toUTF16(s string) []byte {
+	var b []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+	return b
+}
+
+func fromUTF16(b []byte) string {
+	encoded := make([]uint16, len(b)/2)
+	for i := range encoded {
+		encoded[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(encoded))
+}
+
+// datalibHandler serves a one package Datalib listing
+var datalibHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, `<html><body><pre><a href="/SMS_DP_SMSPKG$/Datalib/ABC00001.1">ABC00001.1</a></pre></body></html>`)
+})
+
+func TestNTLMTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		scheme string
+		creds  Credentials
+	}{
+		{"password", "NTLM", Credentials{Username: testUser, Domain: testDomain, Password: testPassword}},
+		{"nthash", "NTLM", Credentials{Username: testDomain + `\` + testUser, NTHash: hex.EncodeToString(ntlm.NTHash(testPassword))}},
+		{"lm:nt pair", "NTLM", Credentials{Username: testUser + "@" + testDomain, NTHash: "aad3b435b51404eeaad3b435b51404ee:" + hex.EncodeToString(ntlm.NTHash(testPassword))}},
+		{"negotiate", "Negotiate", Credentials{Username: testUser, Domain: testDomain, Password: testPassword}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newNTLMServer(tt.scheme)
+			ts := httptest.NewServer(server.wrap(datalibHandler))
+			defer ts.Close()
+
+			tt.creds.Targets = []string{ts.URL}
+			client, err := NewHTTPClient(ClientConfig{UserAgent: "test", Timeout: 5 * time.Second, Credentials: &tt.creds})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l, err := New(ts.URL, client, Options{OutputDir: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			body, err := l.ListDatalib()
+			if err != nil {
+				t.Fatalf("ListDatalib() error: %v", err)
+			}
+			if !strings.Contains(body, "ABC00001.1") {
+				t.Fatalf("ListDatalib() = %q", body)
+			}
+			// Every request goes through its own handshake, the scheme is remembered after the first 401
+			resp, err := client.Get(ts.URL + "/SMS_DP_SMSPKG$/Datalib")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status %d for the second request, want 200", resp.StatusCode)
+			}
+			if got := server.handshakes.Load(); got != 2 {
+				t.Errorf("%d handshakes completed, want 2", got)
+			}
+		})
+	}
+}
+
+func TestNTLMTransportWrongPassword(t *testing.T) {
+	server := newNTLMServer("NTLM")
+	ts := httptest.NewServer(server.wrap(datalibHandler))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(ClientConfig{Timeout: 5 * time.Second, Credentials: &Credentials{Username: testUser, Domain: testDomain, Password: "wrong", Targets: []string{ts.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ts.URL + "/SMS_DP_SMSPKG$/Datalib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status %d with a wrong password, want 401", resp.StatusCode)
+	}
+}
+
+func TestNTLMTransportTargets(t *testing.T) {
+	// Two DPs asking for different schemes, and a host that is not a target
+	ntlmServer, negotiateServer, other := newNTLMServer("NTLM"), newNTLMServer("Negotiate"), newNTLMServer("NTLM")
+	ntlmDP := httptest.NewServer(ntlmServer.wrap(datalibHandler))
+	defer ntlmDP.Close()
+	negotiateDP := httptest.NewServer(negotiateServer.wrap(datalibHandler))
+	defer negotiateDP.Close()
+	otherHost := httptest.NewServer(other.wrap(datalibHandler))
+	defer otherHost.Close()
+	// A target that redirects to the other host, and to itself
+	redirector := newNTLMServer("NTLM")
+	redirectDP := httptest.NewServer(redirector.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/away":
+			http.Redirect(w, r, otherHost.URL+"/SMS_DP_SMSPKG$/Datalib", http.StatusFound)
+		case "/back":
+			http.Redirect(w, r, "/SMS_DP_SMSPKG$/Datalib", http.StatusFound)
+		default:
+			datalibHandler(w, r)
+		}
+	})))
+	defer redirectDP.Close()
+
+	client, err := NewHTTPClient(ClientConfig{Timeout: 5 * time.Second, Credentials: &Credentials{
+		Username: testUser, Domain: testDomain, Password: testPassword,
+		Targets: []string{ntlmDP.URL, negotiateDP.URL, redirectDP.URL},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(url string) int {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Each target keeps its own scheme
+	for range 2 {
+		for _, dp := range []*httptest.Server{ntlmDP, negotiateDP} {
+			if status := get(dp.URL + "/SMS_DP_SMSPKG$/Datalib"); status != http.StatusOK {
+				t.Errorf("status %d from %s, want 200", status, dp.URL)
+			}
+		}
+	}
+	if ntlmServer.handshakes.Load() != 2 || negotiateServer.handshakes.Load() != 2 {
+		t.Errorf("%d NTLM and %d Negotiate handshakes, want 2 each", ntlmServer.handshakes.Load(), negotiateServer.handshakes.Load())
+	}
+
+	// No credentials for other hosts, directly or after a redirect
+	if status := get(otherHost.URL + "/SMS_DP_SMSPKG$/Datalib"); status != http.StatusUnauthorized {
+		t.Errorf("status %d from a host that is not a target, want 401", status)
+	}
+	if status := get(redirectDP.URL + "/away"); status != http.StatusUnauthorized {
+		t.Errorf("status %d after a redirect to another host, want 401", status)
+	}
+	if n := other.negotiates.Load(); n != 0 {
+		t.Errorf("the other host got %d negotiate messages, want none", n)
+	}
+	if status := get(redirectDP.URL + "/back"); status != http.StatusOK {
+		t.Errorf("status %d after a redirect on the same target, want 200", status)
+	}
+}
+
+func TestNewNTLMTransportInvalidHash(t *testing.T) {
+	for _, hash := range []string{"nothex", "0011", strings.Repeat("0", 31)} {
+		if _, err := newNTLMTransport(&http.Transport{}, &Credentials{Username: testUser, NTHash: hash}); err == nil {
+			t.Errorf("newNTLMTransport() accepted the NT hash %q", hash)
+		}
+	}
+}
+
+func TestProbeNTLM(t *testing.T) {
+	server := newNTLMServer("NTLM")
+	ts := httptest.NewServer(server.wrap(datalibHandler))
+	defer ts.Close()
+
+	l, err := New(ts.URL, ts.Client(), Options{OutputDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := l.ProbeNTLM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NetBIOSDomainName != testDomain || info.NetBIOSComputerName != "SCCM01" || l.NTLMInfo() != info {
+		t.Errorf("ProbeNTLM() = %+v", info)
+	}
+}
@@ -0,0 +1,57 @@
+package looter
+
+// Budget is a pool of worker slots shared by every Looter it is given to. It caps
+// the total number of concurrent requests across all DPs in a run.
+type Budget struct {
+	slots chan struct{}
+}
+
+// NewBudget returns a Budget allowing n concurrent requests, or nil (no global limit) if n < 1
+func NewBudget(n int) *Budget {
+	if n < 1 {
+		return nil
+	}
+	return &Budget{slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a slot is free. A nil Budget never blocks.
+func (b *Budget) Acquire() {
+	if b == nil {
+		return
+	}
+	b.slots <- struct{}{}
+}
+
+// Release frees a slot taken with Acquire
+func (b *Budget) Release() {
+	if b == nil {
+		return
+	}
+	<-b.slots
+}
+
+// workers caps the concurrent requests to a single DP at Threads, and takes a slot
+// from the global Budget for each one so a slow DP cannot starve the others
+type workers struct {
+	host   chan struct{}
+	global *Budget
+}
+
+func (l *Looter) newWorkers() *workers {
+	return &workers{
+		host:   make(chan struct{}, l.Threads),
+		global: l.Global,
+	}
+}
+
+// acquire takes up one slot/thread for this DP, then one from the global budget
+func (w *workers) acquire() {
+	w.host <- struct{}{}
+	w.global.Acquire()
+}
+
+// release lets go of the slots taken with acquire
+func (w *workers) release() {
+	w.global.Release()
+	<-w.host
+}
@@ -0,0 +1,69 @@
+package looter
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// ClientConfig holds the settings used to build the HTTP client shared by all requests to a DP
+type ClientConfig struct {
+	UserAgent string
+	// SkipVerify disables HTTPS certificate validation
+	SkipVerify bool
+	Timeout    time.Duration
+	// Proxy is an optional http://, https://, socks5:// or socks5h:// proxy URL for all requests
+	Proxy string
+	// Credentials are used to answer NTLM authentication requests, nil for anonymous access only
+	Credentials *Credentials
+}
+
+// NewHTTPClient builds an http.Client for talking to SCCM DPs
+func NewHTTPClient(cfg ClientConfig) (*http.Client, error) {
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			Renegotiation:      tls.RenegotiateOnceAsClient,
+			InsecureSkipVerify: cfg.SkipVerify,
+		},
+	}
+
+	if cfg.Proxy != "" {
+		if err := setProxy(transport, cfg.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create a custom http.Client
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if cfg.Credentials != nil {
+		ntlmTransport, err := newNTLMTransport(transport, cfg.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = ntlmTransport
+	}
+
+	// Set the User-Agent header globally for this client
+	client.Transport = &customTransport{
+		Transport: roundTripper,
+		UserAgent: cfg.UserAgent,
+	}
+
+	return client, nil
+}
+
+// customTransport is a custom http.RoundTripper that sets the User-Agent header
+type customTransport struct {
+	Transport http.RoundTripper
+	UserAgent string
+}
+
+func (t *customTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", t.UserAgent)
+	return t.Transport.RoundTrip(req)
+}
@@ -0,0 +1,183 @@
+package looter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sccm-http-looter/ntlm"
+)
+
+// maxExpandedHosts caps the number of hosts a single CIDR expands to
+const maxExpandedHosts = 1 << 20
+
+// Candidate is a host and port that may serve a DP
+type Candidate struct {
+	Host   string
+	Port   string
+	Scheme string
+}
+
+// BaseURL returns the base URL of the candidate, as accepted by New and ParseTargets
+func (c Candidate) BaseURL() string {
+	return fmt.Sprintf("%s://%s", c.Scheme, net.JoinHostPort(c.Host, c.Port))
+}
+
+// ExpandHosts returns the hosts of spec, a CIDR (every usable address), an IP address or a host name
+func ExpandHosts(spec string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if !strings.Contains(spec, "/") {
+		if spec == "" {
+			return nil, fmt.Errorf("invalid host: %q", spec)
+		}
+		return []string{strings.Trim(spec, "[]")}, nil
+	}
+
+	prefix, err := netip.ParsePrefix(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR: %s", spec)
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 20 {
+		return nil, fmt.Errorf("CIDR %s has more than %d hosts", spec, maxExpandedHosts)
+	}
+
+	var hosts []string
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr.String())
+	}
+	// The network and broadcast addresses of IPv4 networks are not hosts
+	if prefix.Addr().Is4() && hostBits >= 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// nmapRun is the part of an nmap XML report (-oX) needed to find web servers
+type nmapRun struct {
+	Hosts []struct {
+		Status struct {
+			State string `xml:"state,attr"`
+		} `xml:"status"`
+		Addresses []struct {
+			Addr     string `xml:"addr,attr"`
+			AddrType string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Ports []struct {
+			Protocol string `xml:"protocol,attr"`
+			PortID   string `xml:"portid,attr"`
+			State    struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+			Service struct {
+				Name   string `xml:"name,attr"`
+				Tunnel string `xml:"tunnel,attr"`
+			} `xml:"service"`
+		} `xml:"ports>port"`
+	} `xml:"host"`
+}
+
+// ParseNmapXML returns the open TCP ports of the hosts that are up in an nmap XML report, which are
+// either in ports or identified as HTTP by nmap. Ports in httpsPorts, or identified as SSL or HTTPS,
+// use HTTPS.
+func ParseNmapXML(r io.Reader, ports, httpsPorts []string) ([]Candidate, error) {
+	var run nmapRun
+	if err := xml.NewDecoder(r).Decode(&run); err != nil {
+		return nil, fmt.Errorf("invalid nmap XML report: %w", err)
+	}
+
+	var candidates []Candidate
+	for _, host := range run.Hosts {
+		if host.Status.State != "" && host.Status.State != "up" {
+			continue
+		}
+		address := ""
+		for _, addr := range host.Addresses {
+			if addr.AddrType == "ipv4" || addr.AddrType == "ipv6" {
+				address = addr.Addr
+				break
+			}
+		}
+		if address == "" {
+			continue
+		}
+		for _, port := range host.Ports {
+			if port.Protocol != "tcp" || port.State.State != "open" {
+				continue
+			}
+			service := strings.ToLower(port.Service.Name)
+			if !slices.Contains(ports, port.PortID) && !strings.Contains(service, "http") {
+				continue
+			}
+			scheme := "http"
+			if slices.Contains(httpsPorts, port.PortID) || port.Service.Tunnel == "ssl" || service == "https" {
+				scheme = "https"
+			}
+			candidates = append(candidates, Candidate{Host: address, Port: port.PortID, Scheme: scheme})
+		}
+	}
+	return candidates, nil
+}
+
+// Detection is how a host answered for the DP virtual directories
+type Detection struct {
+	Target string `json:"target"`
+	// DP is set if the host serves SMS_DP_SMSPKG$ or SMS_DP_SMSSIG$
+	DP bool `json:"dp"`
+	// PackageStatus and SignatureStatus are the status codes for the virtual directories, 0 without a response
+	PackageStatus   int    `json:"package_status"`
+	SignatureStatus int    `json:"signature_status"`
+	Server          string `json:"server,omitempty"`
+	// NTLM is what the host disclosed in its NTLM challenge, if it asked for Windows authentication
+	NTLM  *ntlm.ServerInfo `json:"ntlm,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+// Detect finds out whether the DP serves the DP virtual directories. IIS answers 404 for virtual
+// directories that do not exist, so a 200, 401 or 403 means they do, unless the same status is
+// returned for a random path.
+func (l *Looter) Detect() Detection {
+	detection := Detection{Target: l.BaseURL}
+
+	status := func(url string) (int, error) {
+		response, err := l.get(url)
+		if err != nil {
+			return 0, err
+		}
+		defer response.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(response.Body, maxProbeBody))
+		if server := response.Header.Get("Server"); server != "" {
+			detection.Server = server
+		}
+		return response.StatusCode, nil
+	}
+
+	var err error
+	detection.PackageStatus, err = status(fmt.Sprintf("%s/SMS_DP_SMSPKG$/Datalib", l.BaseURL))
+	if err != nil {
+		// Nothing listening, no need to go on
+		detection.Error = err.Error()
+		return detection
+	}
+	detection.SignatureStatus, _ = status(fmt.Sprintf("%s/SMS_DP_SMSSIG$/", l.BaseURL))
+
+	exists := func(statusCode int) bool {
+		return statusCode == http.StatusOK || statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+	}
+	if exists(detection.PackageStatus) || exists(detection.SignatureStatus) {
+		// Servers that answer the same for everything are not DPs
+		control, err := status(fmt.Sprintf("%s/%s$/", l.BaseURL, strconv.FormatInt(rand.Int63(), 36)))
+		detection.DP = err == nil && (exists(detection.PackageStatus) && control != detection.PackageStatus ||
+			exists(detection.SignatureStatus) && control != detection.SignatureStatus)
+	}
+	detection.NTLM = l.NTLMInfo()
+	return detection
+}
@@ -0,0 +1,429 @@
+package looter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListDatalib downloads the Datalib directory listing, saves a copy to the output directory and returns it
+func (l *Looter) ListDatalib() (string, error) {
+	// Ensure the base output directory exists
+	if err := os.MkdirAll(l.OutputDir, os.ModePerm); err != nil {
+		slog.Error(fmt.Sprintf("Error creating base output directory: %v\n", err))
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/SMS_DP_SMSPKG$/Datalib", l.BaseURL)
+	outputFileName := filepath.Join(l.OutputDir, l.Server+"_Datalib.txt")
+
+	// Reuse the listing saved by the previous run
+	if entry, ok := l.state().completed(kindDatalib, url); ok {
+		body, err := os.ReadFile(entry.Path)
+		if err == nil {
+			slog.Info(fmt.Sprintf("Using Datalib listing saved in %s", entry.Path))
+			return string(body), nil
+		}
+	}
+
+	slog.Info(fmt.Sprintf("Getting Datalib listing from %s...\n", url))
+
+	l.Global.Acquire()
+	defer l.Global.Release()
+
+	var body []byte
+	err := l.retry(url, func() error {
+		response, err := l.get(url)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return newStatusError(response)
+		}
+
+		if body, err = io.ReadAll(response.Body); err != nil {
+			return fmt.Errorf("%w: %w", errReadBody, err)
+		}
+		return nil
+	})
+	if err != nil {
+		l.recordResult(journalEntry{Kind: kindDatalib, Key: url, URL: url}, err)
+	}
+	// Only the error of the last attempt counts
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		slog.Error(fmt.Sprintf("Received non-OK status code: %d\n", statusErr.StatusCode))
+		return "", err
+	}
+	if errors.Is(err, errReadBody) {
+		slog.Error(fmt.Sprintf("Error reading response body: %v\n", err))
+		slog.Error(fmt.Sprintf(`
+
+Try to download the Datalib manually with curl:
+curl -k -A 'sccm-http-looter' %s > datalib.html
+then run sccmlooter with '-datalib datalib.html'
+
+`, url))
+		return "", err
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error sending GET request: %v\n", err))
+		return "", err
+	}
+
+	err = os.WriteFile(outputFileName, body, 0644)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error writing to file: %v\n", err))
+		return "", err
+	}
+	l.recordResult(journalEntry{Kind: kindDatalib, Key: url, URL: url, Path: outputFileName}, nil)
+
+	slog.Debug(fmt.Sprintf("Data saved to %s\n", outputFileName))
+	return string(body), nil
+}
+
+func (l *Looter) downloadINIAndFile(outPath, filename, dirName string, wg *sync.WaitGroup, workers *workers) {
+	defer func() {
+		// "Let go" of one slot/thread
+		workers.release()
+		wg.Done()
+	}()
+
+	outputPath, err := safeJoin(outPath, dirName, filename+".INI")
+	if err == nil {
+		// Ensure the output directory exists for the INI
+		err = os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error creating INI output directory: %v", err))
+		return
+	}
+	url := fmt.Sprintf("%s/SMS_DP_SMSPKG$/Datalib/%s/%s.INI", l.BaseURL, dirName, filename)
+
+	// The hash is all that is needed from an INI that was already downloaded
+	var info iniFile
+	if entry, ok := l.state().completed(kindINI, url); ok {
+		info = iniFile{Hash: entry.Hash, HashAlgorithm: entry.HashAlgorithm}
+	} else {
+		err = l.downloadFileFromURL(url, outputPath)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("Error downloading %s: %v\n", filename+".INI", err))
+			l.recordResult(journalEntry{Kind: kindINI, Key: url, URL: url}, err)
+			l.recordDownload(ManifestRecord{ContentID: dirName, OriginalPath: filename, URL: url, Method: methodSignature}, err)
+			return
+		}
+
+		slog.Debug(fmt.Sprintf("Downloaded %s to %s\n", filename+".INI", outputPath))
+		info, err = getFileInfoFromINI(outputPath)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("Error getting Hash from INI file %s: %v", outputPath, err))
+			l.recordResult(journalEntry{Kind: kindINI, Key: url, URL: url}, err)
+			l.recordDownload(ManifestRecord{ContentID: dirName, OriginalPath: filename, URL: url, Method: methodSignature}, err)
+			return
+		}
+		l.recordResult(journalEntry{Kind: kindINI, Key: url, URL: url, Path: outputPath, Hash: info.Hash, HashAlgorithm: info.HashAlgorithm}, nil)
+	}
+	hash := info.Hash
+
+	// Get the actual file by its hash but save it to the correct name
+	relativePath := filename
+	outputPathFile, err := l.filePath(methodSignature, dirName, relativePath, hash)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error creating file output directory: %v", err))
+		return
+	}
+	fileURL := fmt.Sprintf("%s/SMS_DP_SMSPKG$/FileLib/%s/%s", l.BaseURL, hash[0:4], hash)
+
+	// The same name can be in several packages, so files are identified by their package and path
+	fileKey := dirName + "/" + relativePath
+	if _, ok := l.state().completed(kindFile, fileKey); ok {
+		l.stats.countFiles(func(files *FileSummary) { files.Skipped++ })
+		slog.Debug(fmt.Sprintf("Skipping %s, already downloaded", outputPathFile))
+		return
+	}
+	localPath := outputPathFile
+	if l.Store != nil {
+		localPath, err = l.storeFile(hash, dirName, relativePath, outputPathFile, func(outputPath string) error {
+			return l.downloadVerifiedFile(fileURL, outputPath, info)
+		})
+	} else {
+		err = l.downloadVerifiedFile(fileURL, outputPathFile, info)
+	}
+	// Files that were not checked (unknown hash algorithm) are downloaded but not marked as verified
+	_, algorithm, unverifiable := newHasher(info.HashAlgorithm, hash)
+	l.recordResult(journalEntry{Kind: kindFile, Key: fileKey, URL: fileURL, Path: localPath, Hash: hash, HashAlgorithm: info.HashAlgorithm, Verified: unverifiable == nil}, err)
+	record := ManifestRecord{ContentID: dirName, OriginalPath: relativePath, Hash: hash, URL: fileURL, LocalPath: localPath, Method: methodSignature}
+	if unverifiable == nil && algorithm == "SHA256" {
+		// The content was checked against its hash
+		record.SHA256 = strings.ToUpper(hash)
+		if err == nil {
+			l.rememberFileLibHash(hash, dirName, relativePath, localPath)
+		}
+	}
+	l.recordDownload(record, err)
+	if errors.Is(err, errCorrupt) {
+		slog.Warn(fmt.Sprintf("Corrupt download of %s from %s: %v", relativePath, fileURL, err))
+		return
+	}
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Error downloading %s/%s: %v\n", hash[0:4], hash, err))
+		return
+	}
+
+	slog.Debug(fmt.Sprintf("Downloaded %s to %s\n", relativePath, localPath))
+
+}
+
+func (l *Looter) downloadFileFromURL(url, outputPath string) error {
+	return l.downloadFileFromURLWithHash(url, outputPath, nil, nil)
+}
+
+// downloadVerifiedFile downloads url to outputPath and checks the content against the hash from its
+// INI, retrying mismatches. The file is kept without a check if the hash algorithm is unknown.
+func (l *Looter) downloadVerifiedFile(url, outputPath string, info iniFile) error {
+	var err error
+	for attempt := 1; attempt <= verifyAttempts; attempt++ {
+		hasher, algorithm, hashErr := newHasher(info.HashAlgorithm, info.Hash)
+		if hashErr != nil {
+			slog.Debug(fmt.Sprintf("Not verifying %s: %v", url, hashErr))
+			return l.downloadFileFromURL(url, outputPath)
+		}
+
+		err = l.downloadFileFromURLWithHash(url, outputPath, hasher, func() error {
+			actual := strings.ToUpper(hex.EncodeToString(hasher.Sum(nil)))
+			if !strings.EqualFold(actual, info.Hash) {
+				return &hashMismatchError{algorithm: algorithm, expected: strings.ToUpper(info.Hash), actual: actual}
+			}
+			return nil
+		})
+		if !errors.Is(err, errCorrupt) {
+			return err
+		}
+		slog.Debug(fmt.Sprintf("Attempt %d of %s: %v", attempt, url, err))
+	}
+	return err
+}
+
+// downloadFileFromURLWithHash downloads url to outputPath, streaming the content through hasher if it
+// is not nil. The content goes to a temporary file next to outputPath, which only replaces it once the
+// transfer is complete and verify, if not nil, accepts it, so a failed download leaves nothing behind.
+func (l *Looter) downloadFileFromURLWithHash(url, outputPath string, hasher hash.Hash, verify func() error) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(outputPath), ".download-*.part")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+	tmpPath := tmpFile.Name()
+	// Nothing to remove once renamed
+	defer os.Remove(tmpPath)
+
+	err = l.retry(url, func() error {
+		slog.Debug(fmt.Sprintf("Downloading %s", url))
+		// Send HTTP GET request to the URL
+		response, err := l.get(url)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		// Check if the response status code is OK
+		if response.StatusCode != http.StatusOK {
+			return newStatusError(response)
+		}
+		// Truncate what a previous attempt wrote
+		file, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		var writer io.Writer = file
+		if hasher != nil {
+			// Start over if a previous attempt was cut short
+			hasher.Reset()
+			writer = io.MultiWriter(file, hasher)
+		}
+
+		// Copy the response body to the output file
+		if _, err = io.Copy(writer, response.Body); err != nil {
+			return err
+		}
+		return file.Close()
+	})
+	if err != nil {
+		return err
+	}
+	if verify != nil {
+		if err := verify(); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, outputPath)
+}
+
+// get sends a GET request for url once the rate limits allow it, counting it in the requests made to the DP
+func (l *Looter) get(url string) (*http.Response, error) {
+	return l.getWith(l.Client, url)
+}
+
+// getWith is get with another client than the Looter's, i.e. one without credentials
+func (l *Looter) getWith(client *http.Client, url string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l.send(client, request)
+}
+
+// send sends request with client once the rate limits allow it. The first response asking for
+// NTLM or Negotiate authentication has the DP probed for its NTLM challenge.
+func (l *Looter) send(client *http.Client, request *http.Request) (*http.Response, error) {
+	limits := l.rateLimits()
+	for _, r := range limits {
+		r.waitRequest()
+	}
+	l.requests.Add(1)
+
+	start := time.Now()
+	response, err := client.Do(request)
+	statusCode := 0
+	if err == nil {
+		statusCode = response.StatusCode
+		response.Body = &responseBody{ReadCloser: response.Body, limits: limits, stats: l.stats}
+	}
+	l.stats.countResponse(statusCode)
+	for _, r := range limits {
+		r.observe(time.Since(start), statusCode)
+	}
+	if statusCode == http.StatusUnauthorized && authScheme(response.Header.Values("WWW-Authenticate")) != "" && l.ntlmProbed.CompareAndSwap(false, true) {
+		if _, err := l.probeNTLM(request.URL.String()); err != nil {
+			slog.Debug(fmt.Sprintf("Error probing %s for an NTLM challenge: %v", request.URL, err))
+		}
+	}
+	return response, err
+}
+
+// responseBody is a response body read no faster than its rate limits allow, counting the bytes read
+type responseBody struct {
+	io.ReadCloser
+	limits []*RateLimit
+	stats  *runStats
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	// Small reads keep a limited transfer smooth instead of bursting then sleeping
+	if len(b.limits) > 0 && len(p) > 16*1024 {
+		p = p[:16*1024]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.stats.countBytes(n)
+	for _, r := range b.limits {
+		r.waitBytes(n)
+	}
+	return n, err
+}
+
+func (l *Looter) getURL(url string) (string, error) {
+	slog.Debug(fmt.Sprintf("Getting %s\n", url))
+
+	var body []byte
+	err := l.retry(url, func() error {
+		response, err := l.get(url)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return newStatusError(response)
+		}
+
+		body, err = io.ReadAll(response.Body)
+		return err
+	})
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Error getting %s: %v\n", url, err))
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (l *Looter) downloadFileFromURLAsHashName(url string, wg *sync.WaitGroup, workers *workers) (err error) {
+	defer func() {
+		// "Let go" of one slot/thread
+		workers.release()
+		wg.Done()
+	}()
+
+	if _, ok := l.state().completed(kindFile, url); ok {
+		l.stats.countFiles(func(files *FileSummary) { files.Skipped++ })
+		slog.Debug(fmt.Sprintf("Skipping %s, already downloaded", url))
+		return nil
+	}
+	contentID, relativePath := contentPathFromURL(url)
+	var outputPath, hash string
+	defer func() {
+		l.recordResult(journalEntry{Kind: kindFile, Key: url, URL: url, Path: outputPath, Hash: hash}, err)
+		l.recordDownload(ManifestRecord{ContentID: contentID, OriginalPath: relativePath, URL: url, LocalPath: outputPath, Method: methodURL, SHA256: hash}, err)
+	}()
+
+	if relativePath == "" {
+		slog.Debug(fmt.Sprintf("could not get file name from URL: %s", url))
+		return fmt.Errorf("could not get file name from URL: %s", url)
+	}
+
+	// Stream the file to a temporary name, hashing it on the way, as the name depends on the hash
+	tmpFile, err := os.CreateTemp(l.OutputDir, ".download-*.part")
+	if err != nil {
+		slog.Debug(fmt.Sprintf("%v", err))
+		return err
+	}
+	tmpFile.Close()
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	hasher := sha256.New()
+	err = l.downloadFileFromURLWithHash(url, tmpPath, hasher, nil)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("%v", err))
+		return err
+	}
+	hash = strings.ToUpper(hex.EncodeToString(hasher.Sum(nil)))
+
+	outputPath, err = l.filePath(methodURL, contentID, relativePath, hash)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("%v", err))
+		return err
+	}
+
+	slog.Debug(fmt.Sprintf("Output path: %s", outputPath))
+
+	if l.Store != nil {
+		outputPath, err = l.storeFile(hash, contentID, relativePath, outputPath, func(blobPath string) error {
+			return os.Rename(tmpPath, blobPath)
+		})
+	} else if mergedPath, ok := l.mergeWithFileLib(hash, outputPath); ok {
+		slog.Debug(fmt.Sprintf("%s has the same content as %s", url, mergedPath))
+		outputPath = mergedPath
+	} else {
+		err = os.Rename(tmpPath, outputPath)
+	}
+	if err != nil {
+		slog.Debug(fmt.Sprintf("%v", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package looter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDownloadLeavesNoPartialFiles(t *testing.T) {
+	sum := func(content string) string {
+		hash := sha256.Sum256([]byte(content))
+		return strings.ToUpper(hex.EncodeToString(hash[:]))
+	}
+	// The hash in the INI of each file, and what the FileLib serves for it
+	files := map[string]struct {
+		hash, content string
+		truncated     bool
+	}{
+		"good.ps1": {hash: sum("good"), content: "good"},
+		"cut.ps1":  {hash: sum("cut short"), content: "cut short", truncated: true},
+		"bad.ps1":  {hash: sum("expected"), content: "tampered"},
+		// A hash of unknown length, which cannot be checked
+		"odd.ps1": {hash: "0DD0DD0DD0DD0DD0DD0D", content: "odd", truncated: true},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, file := range files {
+			switch strings.ReplaceAll(r.URL.Path, `\`, "/") {
+			case "/SMS_DP_SMSPKG$/Datalib/ABC00001.1/Scripts/" + name + ".INI":
+				fmt.Fprintf(w, "[File]\r\nHash=%s\r\n", file.hash)
+				return
+			case "/SMS_DP_SMSPKG$/FileLib/" + file.hash[:4] + "/" + file.hash:
+				if file.truncated {
+					w.Header().Set("Content-Length", "1000")
+				}
+				io.WriteString(w, file.content)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	for _, layout := range []string{LayoutExtension, LayoutTree} {
+		t.Run(layout, func(t *testing.T) {
+			outputDir := t.TempDir()
+			l, err := New(ts.URL, ts.Client(), Options{OutputDir: outputDir, AllowExtensions: []string{"all"}, Layout: layout, Retry: RetryPolicy{MaxAttempts: 2}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			var entries []SignatureEntry
+			for name := range files {
+				entries = append(entries, SignatureEntry{Path: `Scripts\` + name})
+			}
+			l.Download("ABC00001.1.tar", entries)
+
+			var saved []string
+			filepath.WalkDir(outputDir, func(path string, entry os.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() && strings.Contains(path, string(filepath.Separator)+"files"+string(filepath.Separator)) {
+					saved = append(saved, filepath.Base(path))
+				}
+				if err == nil && strings.HasSuffix(path, ".part") {
+					t.Errorf("temporary file %s left behind", path)
+				}
+				return nil
+			})
+			if len(saved) != 1 || !strings.HasSuffix(saved[0], "good.ps1") {
+				t.Errorf("saved %q, want only good.ps1", saved)
+			}
+			if report := l.Report(nil); report.Files.Downloaded != 1 || report.Files.Failed != 3 {
+				t.Errorf("Files = %+v, want 1 downloaded and 3 failed", report.Files)
+			}
+			var corrupt []string
+			for _, failure := range l.Report(nil).Failures {
+				if failure.Status == statusCorrupt {
+					corrupt = append(corrupt, failure.Key)
+				}
+			}
+			if !slices.Equal(corrupt, []string{"ABC00001.1/Scripts\\bad.ps1"}) {
+				t.Errorf("corrupt downloads %q, want bad.ps1", corrupt)
+			}
+		})
+	}
+}
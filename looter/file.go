@@ -0,0 +1,117 @@
+package looter
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+func walkDir(signaturesDir string) []string {
+	// Initialize a slice to store the file paths
+	filePaths := []string{}
+
+	// Define the function to be called for each file or directory found
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error walking path %s: %v\n", path, err))
+			return nil
+		}
+
+		// Check if it's a regular file (not a directory)
+		if !info.IsDir() {
+			filePaths = append(filePaths, path)
+		}
+
+		return nil
+	}
+
+	// Recursively walk the directory and collect file paths
+	err := filepath.Walk(signaturesDir, walkFn)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error walking directory: %v\n", err))
+		return nil
+	}
+	return filePaths
+}
+
+// iniFile is the information about a file kept in its content library INI
+type iniFile struct {
+	Hash string
+	// HashAlgorithm is the normalized algorithm of Hash if the INI names it, empty otherwise
+	HashAlgorithm string
+}
+
+// getFileInfoFromINI reads the INI at source, a file path or the INI content as []byte
+func getFileInfoFromINI(source any) (iniFile, error) {
+	cfg, err := ini.Load(source)
+	if err != nil {
+		return iniFile{}, err
+	}
+
+	section := cfg.Section("File")
+	if section == nil {
+		return iniFile{}, fmt.Errorf("section 'File' not found in the INI file")
+	}
+
+	hashValue := section.Key("Hash").String()
+	// The hash is used in FileLib URLs and file names, so it must be hex
+	if len(hashValue) < 4 || !isHex(hashValue) {
+		return iniFile{}, fmt.Errorf("no valid Hash in the INI file")
+	}
+	info := iniFile{Hash: hashValue}
+
+	// Older content libraries may not use SHA256, and some name the algorithm
+	for _, key := range []string{"HashAlgorithm", "HashAlg", "HashAlgID"} {
+		if section.HasKey(key) {
+			info.HashAlgorithm = normalizeHashAlgorithm(section.Key(key).String())
+			break
+		}
+	}
+	return info, nil
+}
+
+// writeStringArrayToFile replaces the file at filePath with one string per line. The lines go to a
+// temporary file renamed over it, so the file always holds a complete list.
+func writeStringArrayToFile(filePath string, stringArray []string) error {
+	tmpPath := filePath + ".part"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	// Create a buffered writer
+	writer := bufio.NewWriter(file)
+	for _, line := range stringArray {
+		writer.WriteString(line + "\n")
+	}
+	// Flush the buffered writer to ensure all data is written
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// ReadLines returns the lines of the file at filePath, without blank lines and line endings
+func ReadLines(filePath string) ([]string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
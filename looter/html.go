@@ -0,0 +1,279 @@
+package looter
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// ParseDatalib returns the file and directory names linked from a Datalib listing
+func ParseDatalib(htmlContent string) []string {
+	var fileNames []string
+
+	tokenizer := html.NewTokenizer(strings.NewReader(htmlContent))
+
+	for {
+		tokenType := tokenizer.Next()
+
+		switch tokenType {
+		case html.ErrorToken:
+			return fileNames
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data == "a" {
+				for _, attr := range token.Attr {
+					if attr.Key == "href" {
+						// Extract the file name from the href attribute
+						fileName := extractFileName(attr.Val)
+						if fileName != "" {
+							fileNames = append(fileNames, fileName)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// ListingEntry is a file or directory in an IIS directory listing
+type ListingEntry struct {
+	Name string
+	// URL is the absolute URL of the entry
+	URL   string
+	IsDir bool
+	// Size is the size of a file in bytes, -1 for directories or if unknown
+	Size int64
+	// Modified is the last-modified time shown by IIS, zero if it could not be parsed
+	Modified time.Time
+}
+
+// listingDateLayouts are the date and time formats of IIS listings, which follow the short or, with
+// the LongDate flag, the long date format of the server's locale. They apply to dates normalized by
+// normalizeListingDate, with English month names and no weekday. Ambiguous dates are read month
+// first, like the en-US default.
+var listingDateLayouts = []string{
+	// en-US
+	"1/2/2006 3:04 PM",
+	// en-AU, en-IN
+	"2/1/2006 3:04 PM",
+	// en-GB, fr-FR, es-ES, it-IT, pt-BR
+	"2/1/2006 15:04",
+	"1/2/2006 15:04",
+	// de-DE, ru-RU, pl-PL
+	"2.1.2006 15:04",
+	// nl-NL
+	"2-1-2006 15:04",
+	// sv-SE, zh-CN, ja-JP
+	"2006-1-2 15:04",
+	"2006/1/2 15:04",
+	"2006.1.2 15:04",
+	// Long dates: en-US, then en-GB, de-DE, fr-FR, es-ES, it-IT, nl-NL and pt-BR
+	"January 2 2006 3:04 PM",
+	"January 2 2006 15:04",
+	"2 January 2006 15:04",
+	"2 January 2006 3:04 PM",
+}
+
+// listingMonths are the localized month names of long dates, in the order of the months
+var listingMonths = [][]string{
+	// de, fr, es, it, nl, pt
+	{"januar", "janvier", "enero", "gennaio", "januari", "janeiro"},
+	{"februar", "février", "febrero", "febbraio", "februari", "fevereiro"},
+	{"märz", "mars", "marzo", "marzo", "maart", "março"},
+	{"april", "avril", "abril", "aprile", "april", "abril"},
+	{"mai", "mai", "mayo", "maggio", "mei", "maio"},
+	{"juni", "juin", "junio", "giugno", "juni", "junho"},
+	{"juli", "juillet", "julio", "luglio", "juli", "julho"},
+	{"august", "août", "agosto", "agosto", "augustus", "agosto"},
+	{"september", "septembre", "septiembre", "settembre", "september", "setembro"},
+	{"oktober", "octobre", "octubre", "ottobre", "oktober", "outubro"},
+	{"november", "novembre", "noviembre", "novembre", "november", "novembro"},
+	{"dezember", "décembre", "diciembre", "dicembre", "december", "dezembro"},
+}
+
+// listingSkippedWords are the weekdays and particles of long dates, which are dropped before parsing
+var listingSkippedWords = map[string]bool{}
+
+// listingMonthNames are the English month names by localized name
+var listingMonthNames = map[string]string{}
+
+func init() {
+	for i, names := range listingMonths {
+		for _, name := range names {
+			listingMonthNames[name] = time.Month(i + 1).String()
+		}
+	}
+	for _, word := range strings.Fields(`
+		monday tuesday wednesday thursday friday saturday sunday
+		montag dienstag mittwoch donnerstag freitag samstag sonntag
+		lundi mardi mercredi jeudi vendredi samedi dimanche
+		lunes martes miércoles jueves viernes sábado domingo
+		lunedì martedì mercoledì giovedì venerdì sabato domenica
+		maandag dinsdag woensdag donderdag vrijdag zaterdag zondag
+		segunda-feira terça-feira quarta-feira quinta-feira sexta-feira
+		de del`) {
+		listingSkippedWords[word] = true
+	}
+}
+
+// ParseListing returns the entries of an IIS directory listing (IIS 6 to 10) found at listingURL.
+// Each link is preceded by its date and time, then its size or a localized <dir> marker. Links to
+// other hosts or outside the listed directory are not entries, as IIS never writes them.
+func ParseListing(htmlContent string, listingURL string) []ListingEntry {
+	base, err := url.Parse(listingURL)
+	if err != nil {
+		return nil
+	}
+	// Relative links are relative to the listed directory, even if its URL has no trailing slash
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		if base.RawPath != "" {
+			base.RawPath += "/"
+		}
+	}
+
+	var entries []ListingEntry
+	tokenizer := html.NewTokenizer(strings.NewReader(htmlContent))
+	// text is what was written since the last link or line break, describing the next link
+	var text strings.Builder
+	var current *ListingEntry
+	for {
+		tokenType := tokenizer.Next()
+
+		switch tokenType {
+		case html.ErrorToken:
+			return entries
+		case html.TextToken:
+			if current != nil {
+				current.Name += string(tokenizer.Text())
+			} else {
+				text.Write(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "br", "pre", "tr":
+				text.Reset()
+			case "a":
+				current = listingEntry(base, token, text.String())
+				text.Reset()
+			}
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if token.Data == "a" && current != nil {
+				current.Name = strings.TrimSpace(current.Name)
+				if current.Name == "" {
+					current.Name = extractFileName(strings.TrimSuffix(current.URL, "/"))
+				}
+				entries = append(entries, *current)
+				current = nil
+			}
+		}
+	}
+}
+
+// listingEntry returns the entry for the link token described by text, or nil if the link is not
+// an entry of the listing (i.e. [To Parent Directory]) or not below base
+func listingEntry(base *url.URL, token html.Token, text string) *ListingEntry {
+	var href string
+	for _, attr := range token.Attr {
+		if attr.Key == "href" {
+			href = attr.Val
+		}
+	}
+	if href == "" {
+		return nil
+	}
+	target, err := base.Parse(href)
+	if err != nil || !below(base, target) {
+		return nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+	entry := &ListingEntry{URL: target.String(), Size: -1}
+	last := fields[len(fields)-1]
+	if strings.HasPrefix(last, "<") && strings.HasSuffix(last, ">") {
+		entry.IsDir = true
+	} else if size, ok := parseListingSize(last); ok {
+		entry.Size = size
+	} else {
+		return nil
+	}
+	if strings.HasSuffix(target.Path, "/") {
+		entry.IsDir = true
+		entry.Size = -1
+	}
+	entry.Modified = parseListingDate(strings.Join(fields[:len(fields)-1], " "))
+	return entry
+}
+
+// below returns whether target is on the same host as the directory base and inside it. IIS paths
+// are not case sensitive.
+func below(base, target *url.URL) bool {
+	if origin(target) != origin(base) || len(target.Path) <= len(base.Path) {
+		return false
+	}
+	return strings.EqualFold(target.Path[:len(base.Path)], base.Path)
+}
+
+// parseListingSize parses a file size, ignoring the thousands separators some locales add
+func parseListingSize(field string) (int64, bool) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '.', ' ', '\'':
+			return -1
+		}
+		return r
+	}, field)
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
+
+// parseListingDate parses the date and time of a listing entry, returning the zero time if it is not a known format
+func parseListingDate(value string) time.Time {
+	value = normalizeListingDate(value)
+	for _, layout := range listingDateLayouts {
+		if modified, err := time.Parse(layout, value); err == nil {
+			return modified
+		}
+	}
+	return time.Time{}
+}
+
+// normalizeListingDate rewrites a localized date for listingDateLayouts: weekdays and particles
+// such as "de" are dropped, month names are translated to English and AM/PM markers are upper case
+func normalizeListingDate(value string) string {
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	normalized := fields[:0]
+	for _, field := range fields {
+		switch field {
+		case "am", "a.m.":
+			normalized = append(normalized, "AM")
+			continue
+		case "pm", "p.m.":
+			normalized = append(normalized, "PM")
+			continue
+		}
+		// The day of German long dates is followed by a dot, i.e. "2. Januar 2006"
+		field = strings.TrimSuffix(field, ".")
+		if month, ok := listingMonthNames[field]; ok {
+			field = month
+		}
+		if !listingSkippedWords[field] {
+			normalized = append(normalized, field)
+		}
+	}
+	return strings.Join(normalized, " ")
+}
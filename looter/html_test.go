@@ -0,0 +1,129 @@
+package looter
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// listingGolden is the golden file of a listing fixture: the URL it was listed from and its entries
+type listingGolden struct {
+	URL     string         `json:"url"`
+	Entries []ListingEntry `json:"entries"`
+}
+
+// TestParseListingGolden parses the listings of testdata/listing, from IIS 7, 8.5 and 10 in several
+// locales, and compares the entries with the .json golden file next to each one
+func TestParseListingGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "listing", "*.html"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no listing fixtures: %v", err)
+	}
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".html")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goldenPath := strings.TrimSuffix(fixture, ".html") + ".json"
+			var golden listingGolden
+			if data, err := os.ReadFile(goldenPath); err == nil {
+				if err := json.Unmarshal(data, &golden); err != nil {
+					t.Fatal(err)
+				}
+			} else if !*update {
+				t.Fatal(err)
+			}
+			if golden.URL == "" {
+				golden.URL = "http://sccm01.corp.local/SMS_DP_SMSPKG$/ABC00012"
+			}
+
+			entries := ParseListing(string(content), golden.URL)
+			if *update {
+				data, err := json.MarshalIndent(listingGolden{URL: golden.URL, Entries: entries}, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenPath, append(data, '\n'), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if len(entries) != len(golden.Entries) {
+				t.Fatalf("ParseListing() = %+v, want %+v", entries, golden.Entries)
+			}
+			for i, entry := range entries {
+				want := golden.Entries[i]
+				if entry.Name != want.Name || entry.URL != want.URL || entry.IsDir != want.IsDir || entry.Size != want.Size || !entry.Modified.Equal(want.Modified) {
+					t.Errorf("entry %d = %+v, want %+v", i, entry, want)
+				}
+				if entry.Modified.IsZero() {
+					t.Errorf("entry %d has no last-modified time", i)
+				}
+			}
+		})
+	}
+}
+
+func TestParseListingDate(t *testing.T) {
+	want := time.Date(2024, 9, 25, 13, 23, 0, 0, time.UTC)
+	for _, value := range []string{
+		"9/25/2024  1:23 PM",
+		"9/25/2024 1:23 p.m.",
+		"25/9/2024 1:23 PM",
+		"25/09/2024 13:23",
+		"25.09.2024 13:23",
+		"25-9-2024 13:23",
+		"2024-09-25 13:23",
+		"2024/09/25 13:23",
+		"Wednesday, September 25, 2024 1:23 PM",
+		"Wednesday, 25 September 2024 13:23",
+		"Mittwoch, 25. September 2024 13:23",
+		"mercredi 25 septembre 2024 13:23",
+		"miércoles, 25 de septiembre de 2024 13:23",
+		"mercoledì 25 settembre 2024 13:23",
+		"woensdag 25 september 2024 13:23",
+		"quarta-feira, 25 de setembro de 2024 13:23",
+	} {
+		if got := parseListingDate(value); !got.Equal(want) {
+			t.Errorf("parseListingDate(%q) = %v, want %v", value, got, want)
+		}
+	}
+	// Ambiguous dates are read month first
+	if got := parseListingDate("3/4/2024 9:15 AM"); got.Month() != time.March {
+		t.Errorf("parseListingDate(3/4/2024) = %v, want March 4", got)
+	}
+	if got := parseListingDate("not a date"); !got.IsZero() {
+		t.Errorf("parseListingDate(not a date) = %v, want zero", got)
+	}
+}
+
+func TestParseListingForeignLinks(t *testing.T) {
+	listing := `<pre><A HREF="/SMS_DP_SMSPKG$/">[To Parent Directory]</A><br><br>` +
+		` 9/25/2024  1:23 PM        &lt;dir&gt; <A HREF="/SMS_DP_SMSPKG$/ABC00012/Scripts/">Scripts</A><br>` +
+		` 9/25/2024  1:23 PM         2048 <A HREF="http://SCCM01.corp.local:80/sms_dp_smspkg$/abc00012/setup.ps1">setup.ps1</A><br>` +
+		` 9/25/2024  1:23 PM        &lt;dir&gt; <A HREF="/SMS_DP_SMSPKG$/">parent</A><br>` +
+		` 9/25/2024  1:23 PM        &lt;dir&gt; <A HREF="/SMS_DP_SMSPKG$/ABC00012/">itself</A><br>` +
+		` 9/25/2024  1:23 PM        &lt;dir&gt; <A HREF="../ABC00013/">sibling</A><br>` +
+		` 9/25/2024  1:23 PM         2048 <A HREF="/SMS_DP_SMSPKG$/ABC000123/a.txt">prefix</A><br>` +
+		` 9/25/2024  1:23 PM         2048 <A HREF="http://attacker.invalid/SMS_DP_SMSPKG$/ABC00012/a.txt">other host</A><br>` +
+		` 9/25/2024  1:23 PM         2048 <A HREF="https://sccm01.corp.local/SMS_DP_SMSPKG$/ABC00012/a.txt">other scheme</A><br>` +
+		` 9/25/2024  1:23 PM         2048 <A HREF="//attacker.invalid/a.txt">no scheme</A><br></pre>`
+
+	var names []string
+	for _, entry := range ParseListing(listing, "http://sccm01.corp.local/SMS_DP_SMSPKG$/ABC00012") {
+		names = append(names, entry.Name)
+	}
+	if want := []string{"Scripts", "setup.ps1"}; !slices.Equal(names, want) {
+		t.Errorf("ParseListing() = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,180 @@
+package looter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// journalFileName is the state journal in the output directory of a DP
+const journalFileName = "state.jsonl"
+
+// Journal entry kinds
+const (
+	kindDatalib = "datalib"
+	kindURLs    = "urls"
+	// kindListing is the directory listing of a package or of one of its directories
+	kindListing   = "listing"
+	kindSignature = "signature"
+	kindINI       = "ini"
+	kindFile      = "file"
+)
+
+// Journal entry statuses
+const (
+	statusDone   = "done"
+	statusFailed = "failed"
+	// statusCorrupt is a download that did not match its expected hash
+	statusCorrupt = "corrupt"
+)
+
+// journalEntry records the outcome of one unit of work. Key identifies the work within its
+// kind, i.e. the URL of a signature or the output path of a file.
+type journalEntry struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	URL    string `json:"url,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+	// HashAlgorithm is set when the INI names the algorithm of Hash
+	HashAlgorithm string `json:"hash_algorithm,omitempty"`
+	// Verified is set when the content was checked against Hash
+	Verified bool   `json:"verified,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Failure is whether a failed request was transient or permanent
+	Failure FailureClass `json:"failure,omitempty"`
+	Time    time.Time    `json:"time"`
+}
+
+// journal is an append-only JSONL log of completed and failed work, safe for concurrent use.
+// When resuming, the entries from the previous run are loaded so completed work can be skipped.
+type journal struct {
+	mu      sync.Mutex
+	file    *jsonlFile
+	entries map[string]journalEntry
+}
+
+// openJournal opens the journal in outputDir, loading the previous entries if resume is set
+// and starting a new journal otherwise
+func openJournal(outputDir string, resume bool) (*journal, error) {
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(outputDir, journalFileName)
+	j := &journal{entries: make(map[string]journalEntry)}
+
+	if resume {
+		if err := j.load(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		slog.Info(fmt.Sprintf("Resuming from %s with %d completed items", path, j.completedCount()))
+	}
+
+	file, err := openJSONL(path, !resume)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+	return j, nil
+}
+
+func (j *journal) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		// A run that was killed may have left a partial last line
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		j.entries[journalKey(entry.Kind, entry.Key)] = entry
+	}
+	return scanner.Err()
+}
+
+func journalKey(kind, key string) string {
+	return kind + "\x00" + key
+}
+
+func (j *journal) completedCount() int {
+	count := 0
+	for _, entry := range j.entries {
+		if entry.Status == statusDone {
+			count++
+		}
+	}
+	return count
+}
+
+// completed returns the entry for kind and key if that work is done and its output is still on disk
+func (j *journal) completed(kind, key string) (journalEntry, bool) {
+	if j == nil {
+		return journalEntry{}, false
+	}
+	j.mu.Lock()
+	entry, ok := j.entries[journalKey(kind, key)]
+	j.mu.Unlock()
+	if !ok || entry.Status != statusDone {
+		return journalEntry{}, false
+	}
+	if entry.Path != "" {
+		if _, err := os.Stat(entry.Path); err != nil {
+			return journalEntry{}, false
+		}
+	}
+	return entry, true
+}
+
+// record appends entry to the journal
+func (j *journal) record(entry journalEntry) {
+	if j == nil {
+		return
+	}
+	entry.Time = time.Now().UTC()
+
+	j.mu.Lock()
+	j.entries[journalKey(entry.Kind, entry.Key)] = entry
+	j.mu.Unlock()
+	if err := j.file.write(entry); err != nil {
+		slog.Error(fmt.Sprintf("Error writing to journal: %v", err))
+	}
+}
+
+// recordResult records entry as done, or as failed (or corrupt) with err
+func (j *journal) recordResult(entry journalEntry, err error) {
+	entry.Status = statusDone
+	if err != nil {
+		entry.Status = statusFailed
+		if errors.Is(err, errCorrupt) {
+			entry.Status = statusCorrupt
+		}
+		entry.Path = ""
+		entry.Verified = false
+		entry.Error = err.Error()
+		var requestErr *RequestError
+		if errors.As(err, &requestErr) {
+			entry.Failure = requestErr.Class
+		}
+	}
+	j.record(entry)
+}
+
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.close()
+}
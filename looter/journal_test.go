@@ -0,0 +1,165 @@
+package looter
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestJournalResume(t *testing.T) {
+	outputDir := t.TempDir()
+	saved := filepath.Join(outputDir, "a.txt")
+	if err := os.WriteFile(saved, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := openJournal(outputDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.recordResult(journalEntry{Kind: kindFile, Key: "a", Path: saved}, nil)
+	j.recordResult(journalEntry{Kind: kindFile, Key: "deleted", Path: filepath.Join(outputDir, "deleted.txt")}, nil)
+	j.recordResult(journalEntry{Kind: kindFile, Key: "b", Path: filepath.Join(outputDir, "b.txt")}, &RequestError{Class: FailureTransient, Err: errors.New("i/o timeout")})
+	j.recordResult(journalEntry{Kind: kindSignature, Key: "a"}, nil)
+	// Failed, then done on a retry: the last entry wins
+	j.recordResult(journalEntry{Kind: kindINI, Key: "c"}, errors.New("HTTP 503"))
+	j.recordResult(journalEntry{Kind: kindINI, Key: "c"}, nil)
+	if err := j.close(); err != nil {
+		t.Fatal(err)
+	}
+	// A run that was killed mid-write
+	file, err := os.OpenFile(filepath.Join(outputDir, journalFileName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"kind":"file","key":"partial","status":"do`)
+	file.Close()
+
+	j, err = openJournal(outputDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.close()
+	for _, tt := range []struct {
+		kind, key string
+		want      bool
+	}{
+		{kindFile, "a", true},
+		// Its output is gone
+		{kindFile, "deleted", false},
+		{kindFile, "b", false},
+		{kindFile, "partial", false},
+		{kindFile, "unknown", false},
+		// Keys are per kind
+		{kindSignature, "a", true},
+		{kindURLs, "a", false},
+		{kindINI, "c", true},
+	} {
+		if _, ok := j.completed(tt.kind, tt.key); ok != tt.want {
+			t.Errorf("completed(%s, %s) = %v, want %v", tt.kind, tt.key, ok, tt.want)
+		}
+	}
+	entry := j.entries[journalKey(kindFile, "b")]
+	if entry.Status != statusFailed || entry.Failure != FailureTransient || entry.Path != "" {
+		t.Errorf("failed entry = %+v, want a transient failure without a path", entry)
+	}
+	if n := j.completedCount(); n != 4 {
+		t.Errorf("completedCount() = %d, want 4", n)
+	}
+
+	// A run that does not resume starts a new journal
+	j, err = openJournal(outputDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.close()
+	if _, ok := j.completed(kindFile, "a"); ok {
+		t.Error("a new journal has the entries of the previous run")
+	}
+	if info, err := os.Stat(filepath.Join(outputDir, journalFileName)); err != nil || info.Size() != 0 {
+		t.Errorf("the journal was not truncated: %v, %v", info, err)
+	}
+}
+
+func TestResumeDownloads(t *testing.T) {
+	// b.txt fails on the first run only
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+		if r.URL.Path == "/SMS_DP_SMSPKG$/ABC00001.1/b.txt" && n == 1 {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, filepath.Base(r.URL.Path))
+	}))
+	defer ts.Close()
+	urls := []string{ts.URL + "/SMS_DP_SMSPKG$/ABC00001.1/a.txt", ts.URL + "/SMS_DP_SMSPKG$/ABC00001.1/b.txt"}
+
+	outputDir := t.TempDir()
+	run := func() *Report {
+		l, err := New(ts.URL, ts.Client(), Options{OutputDir: outputDir, AllowExtensions: []string{"all"}, Resume: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		l.DownloadURLs(urls)
+		return l.Report(nil)
+	}
+
+	if report := run(); report.Files.Downloaded != 1 || report.Files.Failed != 1 || report.Outcome != OutcomePartial {
+		t.Fatalf("first run = %+v, want a.txt downloaded and b.txt failed", report.Files)
+	}
+	report := run()
+	if report.Files.Downloaded != 1 || report.Files.Skipped != 1 || report.Files.Failed != 0 || report.Outcome != OutcomeComplete {
+		t.Errorf("resumed run = %+v, want a.txt skipped and b.txt downloaded", report.Files)
+	}
+	if a, b := requests["/SMS_DP_SMSPKG$/ABC00001.1/a.txt"], requests["/SMS_DP_SMSPKG$/ABC00001.1/b.txt"]; a != 1 || b != 2 {
+		t.Errorf("a.txt requested %d times and b.txt %d times, want 1 and 2", a, b)
+	}
+}
+
+func TestResumeURLList(t *testing.T) {
+	dp := &combinedDP{requests: make(map[string]int)}
+	ts := httptest.NewServer(dp)
+	defer ts.Close()
+
+	outputDir := t.TempDir()
+	run := func(resume bool) ([]string, *Report) {
+		l, err := New(ts.URL, ts.Client(), Options{OutputDir: outputDir, AllowExtensions: []string{"all"}, Resume: resume})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		urls := l.ResolveFiles([]string{"ABC00001.1"})
+		l.DownloadURLs(urls)
+		return urls, l.Report(nil)
+	}
+	// Runs that list the packages again replace the saved URLs, the resumed one reuses them
+	run(false)
+	run(false)
+	listings := dp.requests["/SMS_DP_SMSPKG$/ABC00001.1"]
+	urls, report := run(true)
+	if len(urls) != 2 || !slices.Contains(urls, ts.URL+"/SMS_DP_SMSPKG$/ABC00001.1/sub/a.txt") {
+		t.Errorf("ResolveFiles() = %q, want the 2 files of ABC00001.1", urls)
+	}
+	if dp.requests["/SMS_DP_SMSPKG$/ABC00001.1"] != listings {
+		t.Error("the resumed run listed the package again")
+	}
+	if report.Outcome != OutcomeComplete || report.Files.Enumerated != 2 || report.Files.Skipped != 2 {
+		t.Errorf("Report() = %s with %+v, want complete with 2 files skipped", report.Outcome, report.Files)
+	}
+	saved, err := ReadLines(filepath.Join(outputDir, "127.0.0.1_urls.txt"))
+	if err != nil || !slices.Equal(saved, urls) {
+		t.Errorf("saved URLs = %q, %v, want %q", saved, err, urls)
+	}
+}
@@ -0,0 +1,44 @@
+package looter
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// jsonlFile appends JSON records to a file, one per line, and is safe for concurrent use
+type jsonlFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openJSONL opens path for appending, emptying it first if truncate is set
+func openJSONL(path string, truncate bool) (*jsonlFile, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlFile{file: file}, nil
+}
+
+// write appends record as a single line. One write per line keeps the file readable if the process is killed.
+func (f *jsonlFile) write(record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
+
+func (f *jsonlFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,49 @@
+package looter
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Output layouts for downloaded files
+const (
+	// LayoutExtension groups files by extension as files/<ext>/<hash>_<method>_<name>
+	LayoutExtension = "ext"
+	// LayoutTree recreates the packages as files/<content ID>/<relative path>
+	LayoutTree = "tree"
+)
+
+// Methods used to find files, used in file names of the extension layout
+const (
+	methodSignature = "sig"
+	methodURL       = "url"
+)
+
+// filePath returns where to save the file at relativePath in package contentID, found with method
+// and having hash, creating its directory. The names from the DP are made safe and confined to the output directory.
+func (l *Looter) filePath(method, contentID, relativePath, hash string) (string, error) {
+	var outputPath string
+	var err error
+	switch l.Layout {
+	case LayoutTree:
+		outputPath, err = safeJoin(filepath.Join(l.OutputDir, "files"), contentID, relativePath)
+	default:
+		extension := strings.TrimPrefix(path.Ext(sanitizeRelativePath(relativePath)), ".")
+		if extension == "" {
+			extension = "UKN"
+		}
+		// The full hash, as two files with the same name can share the start of their hash
+		outputPath, err = safeJoin(filepath.Join(l.OutputDir, "files"), extension, hash+"_"+method+"_"+path.Base(sanitizeRelativePath(relativePath)))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Ensure the output directory exists for files
+	if err := os.MkdirAll(filepath.Dir(outputPath), os.ModePerm); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
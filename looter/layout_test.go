@@ -0,0 +1,27 @@
+package looter
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFilePath(t *testing.T) {
+	outputDir := t.TempDir()
+	// Two files with the same name whose hashes start alike
+	first, second := "ABCD0001", "ABCD0002"
+	for _, tt := range []struct {
+		layout, method, contentID, relativePath, hash string
+		want                                          string
+	}{
+		{LayoutExtension, methodSignature, "ABC00001.1", `Scripts\setup.ps1`, first, filepath.Join("ps1", first+"_sig_setup.ps1")},
+		{LayoutExtension, methodURL, "ABC00002.1", "setup.ps1", second, filepath.Join("ps1", second+"_url_setup.ps1")},
+		{LayoutExtension, methodURL, "ABC00002.1", "README", second, filepath.Join("UKN", second+"_url_README")},
+		{LayoutTree, methodSignature, "ABC00001.1", `Scripts\setup.ps1`, first, filepath.Join("ABC00001.1", "Scripts", "setup.ps1")},
+	} {
+		l := &Looter{Options: Options{OutputDir: outputDir, Layout: tt.layout}}
+		got, err := l.filePath(tt.method, tt.contentID, tt.relativePath, tt.hash)
+		if want := filepath.Join(outputDir, "files", tt.want); err != nil || got != want {
+			t.Errorf("filePath(%s, %s) with layout %s = %s, %v, want %s", tt.contentID, tt.relativePath, tt.layout, got, err, want)
+		}
+	}
+}
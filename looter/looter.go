@@ -0,0 +1,139 @@
+// Package looter retrieves files from SCCM distribution points over HTTP(S).
+//
+// A Looter targets a single distribution point. Several Looters can be used in
+// the same process as they share no state.
+package looter
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Options controls what a Looter downloads and how.
+type Options struct {
+	// OutputDir is the base output directory for files related to this DP
+	OutputDir string
+	// AllowExtensions is the list of file extensions (no dot) to download, "all" allows everything
+	AllowExtensions []string
+	// DownloadNoExt downloads files without a file extension
+	DownloadNoExt bool
+	// Threads is the number of concurrent requests
+	Threads int
+	// Randomize randomizes the order of requests for signatures and files
+	Randomize bool
+	// Global is an optional worker budget shared with other Looters
+	Global *Budget
+	// HideProgress disables the progress bars, i.e. when several DPs are looted at once
+	HideProgress bool
+	// Resume skips work recorded as completed in the state journal of a previous run
+	Resume bool
+	// Store is an optional content store, so each unique file is downloaded and saved once
+	Store *ContentStore
+	// Layout is how downloaded files are arranged, LayoutExtension (the default) or LayoutTree
+	Layout string
+	// Link is how files in the Store are placed in the files/<ext>/ layout (LinkHard, LinkSymlink, LinkCopy or LinkNone)
+	Link string
+	// RequestsPerSecond and BytesPerSecond limit the requests to this DP, 0 for no limit
+	RequestsPerSecond float64
+	BytesPerSecond    int64
+	// Adaptive lowers the request rate of this DP when it slows down or answers 429 or 503, up to RequestsPerSecond
+	Adaptive bool
+	// GlobalRate is an optional rate limit shared with other Looters
+	GlobalRate *RateLimit
+	// Retry is how failed requests are retried, DefaultRetryPolicy if MaxAttempts is 0
+	Retry RetryPolicy
+	// OnDownload is called with the manifest record of every file saved, from the download workers
+	OnDownload func(record ManifestRecord)
+}
+
+// Looter loots a single SCCM distribution point.
+type Looter struct {
+	Client  *http.Client
+	BaseURL string
+	// Server is the host name of the DP, used to name output files
+	Server string
+	Options
+
+	journalOnce sync.Once
+	journal     *journal
+
+	manifestOnce sync.Once
+	manifest     *jsonlFile
+
+	// stats is what happened while looting, for the Report
+	stats *runStats
+	// rate is the rate limit of this DP, nil if there is none
+	rate *RateLimit
+	// requests is the number of HTTP requests sent to the DP
+	requests atomic.Int64
+	// transientFailures and permanentFailures count the requests that failed for good
+	transientFailures atomic.Int64
+	permanentFailures atomic.Int64
+	// ntlmProbed is set once the DP was probed for its NTLM challenge
+	ntlmProbed atomic.Bool
+	// fileLibHashes holds where the files downloaded from the FileLib were saved, by SHA-256
+	fileLibHashes sync.Map
+	// fileLibPaths holds the SHA-256 of the files downloaded from the FileLib, by fileLibKey
+	fileLibPaths sync.Map
+	// listedSizes holds the size of the files seen in directory listings, by URL
+	listedSizes sync.Map
+	// signatureFiles holds the fileLibKey of every file found in a signature
+	signatureFiles sync.Map
+}
+
+// New returns a Looter for the DP at baseURL (i.e. http://10.0.0.1:80).
+func New(baseURL string, client *http.Client, opts Options) (*Looter, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL: %s", baseURL)
+	}
+	if opts.Threads < 1 {
+		opts.Threads = 1
+	}
+	if opts.Retry.MaxAttempts == 0 {
+		opts.Retry = DefaultRetryPolicy()
+	}
+	return &Looter{
+		Client:  client,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Server:  u.Hostname(),
+		Options: opts,
+		stats:   newRunStats(),
+		rate:    NewRateLimit(opts.RequestsPerSecond, opts.BytesPerSecond, opts.Adaptive),
+	}, nil
+}
+
+// state returns the state journal of this DP, opening it on first use. It returns nil
+// (and work is not journaled) if the journal cannot be opened.
+func (l *Looter) state() *journal {
+	l.journalOnce.Do(func() {
+		j, err := openJournal(l.OutputDir, l.Resume)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error opening state journal: %v", err))
+			return
+		}
+		l.journal = j
+	})
+	return l.journal
+}
+
+// Requests returns the number of HTTP requests sent to the DP so far
+func (l *Looter) Requests() int64 {
+	return l.requests.Load()
+}
+
+// Close releases the files held open by the Looter
+func (l *Looter) Close() error {
+	if l.manifest != nil {
+		l.manifest.close()
+	}
+	return l.journal.close()
+}
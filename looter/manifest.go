@@ -0,0 +1,120 @@
+package looter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestFileName lists every file found on a DP in its output directory
+const ManifestFileName = "manifest.jsonl"
+
+// Manifest record statuses, besides statusFailed and statusCorrupt
+const (
+	manifestDownloaded = "downloaded"
+	// manifestFiltered is a file skipped by the extension filters
+	manifestFiltered = "filtered"
+)
+
+// ManifestRecord describes a file found on a DP and whether it was saved. OriginalPath is the
+// path as named by the DP, before it was made safe to write to disk.
+type ManifestRecord struct {
+	ContentID    string `json:"content_id"`
+	OriginalPath string `json:"original_path"`
+	// Hash is the FileLib hash from the INI of the file, for the signature method
+	Hash string `json:"hash,omitempty"`
+	// URL is where the file was downloaded from
+	URL string `json:"url,omitempty"`
+	// Size is the size of the downloaded file, or of a filtered file from its directory listing
+	Size      int64  `json:"size,omitempty"`
+	LocalPath string `json:"local_path,omitempty"`
+	// Method is how the file was found, "sig" (signatures) or "url" (directory listings)
+	Method string `json:"method"`
+	// Status is "downloaded", "filtered", "failed" or "corrupt"
+	Status string `json:"status"`
+	// SHA256 is the SHA-256 of the downloaded file
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// recordDownload adds the manifest record of a file saved to record.LocalPath, or that failed with err.
+// The size and SHA-256 of a saved file are filled in if they are not set.
+func (l *Looter) recordDownload(record ManifestRecord, err error) {
+	if err != nil {
+		record.Status = statusFailed
+		if errors.Is(err, errCorrupt) {
+			record.Status = statusCorrupt
+		}
+		record.Error = err.Error()
+		record.LocalPath = ""
+		record.SHA256 = ""
+		l.recordFile(record)
+		return
+	}
+
+	record.Status = manifestDownloaded
+	if info, err := os.Stat(record.LocalPath); err == nil {
+		record.Size = info.Size()
+	}
+	if record.SHA256 == "" {
+		if sum, err := fileSHA256(record.LocalPath); err == nil {
+			record.SHA256 = sum
+		} else {
+			slog.Debug(fmt.Sprintf("Error hashing %s: %v", record.LocalPath, err))
+		}
+	}
+	l.recordFile(record)
+	if l.OnDownload != nil {
+		l.OnDownload(record)
+	}
+}
+
+// recordFiltered adds the manifest record of a file skipped by the extension filters. A resumed
+// run does not, as the run it resumes already did.
+func (l *Looter) recordFiltered(record ManifestRecord) {
+	if l.Resume {
+		return
+	}
+	record.Status = manifestFiltered
+	l.recordFile(record)
+}
+
+// fileSHA256 returns the upper case hex SHA-256 of the file at filePath
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(hasher.Sum(nil))), nil
+}
+
+// recordFile appends record to the manifest of this DP, opening it on first use
+func (l *Looter) recordFile(record ManifestRecord) {
+	l.manifestOnce.Do(func() {
+		// Records for work skipped when resuming are in the manifest of the previous run
+		manifest, err := openJSONL(filepath.Join(l.OutputDir, ManifestFileName), !l.Resume)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error opening manifest: %v", err))
+			return
+		}
+		l.manifest = manifest
+	})
+	if l.manifest == nil {
+		return
+	}
+	if err := l.manifest.write(record); err != nil {
+		slog.Error(fmt.Sprintf("Error writing to manifest: %v", err))
+	}
+}
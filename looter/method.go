@@ -0,0 +1,172 @@
+package looter
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// probeCount is the number of content IDs tried by ProbeMethods
+const probeCount = 3
+
+// methodCombined is the report method of DownloadCombined
+const methodCombined = "sig+url"
+
+// MethodSupport is how files can be found on a DP
+type MethodSupport struct {
+	// Listing is set if packages can be browsed with IIS directory listings
+	Listing bool
+	// Signatures is set if SMSSIG signatures can be downloaded
+	Signatures bool
+}
+
+// ProbeMethods finds out whether the DP allows directory listing and signature downloads by trying
+// both on a few content IDs from dataLibFiles (the names from its Datalib listing)
+func (l *Looter) ProbeMethods(dataLibFiles []string) MethodSupport {
+	var support MethodSupport
+	probed := 0
+	for _, name := range dataLibFiles {
+		if strings.HasSuffix(name, ".INI") || name == "" {
+			continue
+		}
+		if probed == probeCount || (support.Listing && support.Signatures) {
+			break
+		}
+		probed++
+
+		if !support.Listing {
+			status, _ := l.probe(fmt.Sprintf("%s/SMS_DP_SMSPKG$/%s", l.BaseURL, name))
+			support.Listing = status == http.StatusOK
+		}
+		if !support.Signatures {
+			status, body := l.probe(fmt.Sprintf("%s/SMS_DP_SMSSIG$/%s.tar", l.BaseURL, name))
+			if status == http.StatusOK {
+				entries, err := ParseSignature(body)
+				support.Signatures = err == nil && len(entries) > 0
+			}
+		}
+	}
+	slog.Debug(fmt.Sprintf("Probed %d content IDs of %s: directory listing %v, signatures %v", probed, l.BaseURL, support.Listing, support.Signatures))
+	return support
+}
+
+// probe sends a single GET request for url, returning its status code (0 on error) and body
+func (l *Looter) probe(url string) (int, []byte) {
+	response, err := l.get(url)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Error probing %s: %v", url, err))
+		return 0, nil
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, nil
+	}
+	return response.StatusCode, body
+}
+
+// DownloadCombined uses both methods on a DP that allows both: files are found through the signature
+// of every package that has one, then through the directory listing of every package, which finds
+// the files missing from the signatures. Listed files that were already downloaded from the FileLib
+// are skipped, and those with the same content as a FileLib file are not saved twice.
+func (l *Looter) DownloadCombined(dataLibFiles []string) {
+	signaturePaths := l.FetchSignatures(dataLibFiles)
+	l.DownloadFromSignatures(signaturePaths)
+
+	slog.Info(fmt.Sprintf("Listing the packages of %s for files missing from the signatures", l.BaseURL))
+	var listed []string
+	downloaded := 0
+	for _, fileURL := range l.ResolveFiles(dataLibFiles) {
+		if fileURL == "" {
+			continue
+		}
+		contentID, relativePath := contentPathFromURL(fileURL)
+		if _, ok := l.fileLibPath(contentID, relativePath); ok {
+			downloaded++
+			continue
+		}
+		// Files of the signatures left out by the filters are already in the report and manifest
+		if _, ok := l.signatureFiles.Load(fileLibKey(contentID, relativePath)); ok && !l.fileWanted(relativePath) {
+			continue
+		}
+		listed = append(listed, fileURL)
+	}
+	slog.Info(fmt.Sprintf("%d listed files of %s were downloaded from the FileLib, %d left", downloaded, l.BaseURL, len(listed)))
+	l.stats.countFiles(func(files *FileSummary) { files.Skipped += int64(downloaded) })
+	l.skipListedSignatures()
+	l.DownloadURLs(listed)
+	l.stats.setMethod(methodCombined)
+}
+
+// skipListedSignatures drops the failed signatures of the packages whose directory listings all went
+// through from the report, as the listings found every file of those packages
+func (l *Looter) skipListedSignatures() {
+	unlisted := make(map[string]bool)
+	for _, failure := range l.stats.failuresOf(kindListing) {
+		contentID, _ := contentPathFromURL(failure.URL)
+		unlisted[strings.ToUpper(contentID)] = true
+	}
+	skipped := l.stats.dropFailures(func(failure ItemFailure) bool {
+		if failure.Kind != kindSignature {
+			return false
+		}
+		_, name, _ := strings.Cut(failure.URL, "/SMS_DP_SMSSIG$/")
+		return !unlisted[strings.ToUpper(strings.TrimSuffix(name, ".tar"))]
+	})
+	if skipped > 0 {
+		slog.Debug(fmt.Sprintf("%d packages of %s without a signature were listed instead", skipped, l.BaseURL))
+	}
+}
+
+// fileLibKey is the key of a file of a package in fileLibPaths, whatever its path separators
+func fileLibKey(contentID, relativePath string) string {
+	return contentID + "/" + strings.ReplaceAll(relativePath, `\`, "/")
+}
+
+// rememberFileLibHash records that the file at relativePath in the package contentID has the
+// SHA-256 hash and that its FileLib content was saved to localPath
+func (l *Looter) rememberFileLibHash(hash, contentID, relativePath, localPath string) {
+	hash = strings.ToUpper(hash)
+	l.fileLibHashes.Store(hash, localPath)
+	l.fileLibPaths.Store(fileLibKey(contentID, relativePath), hash)
+}
+
+// fileLibPath returns where the file at relativePath in the package contentID was saved if it was
+// downloaded from the FileLib
+func (l *Looter) fileLibPath(contentID, relativePath string) (string, bool) {
+	hash, ok := l.fileLibPaths.Load(fileLibKey(contentID, relativePath))
+	if !ok {
+		return "", false
+	}
+	localPath, ok := l.fileLibHashes.Load(hash)
+	if !ok {
+		return "", false
+	}
+	return localPath.(string), true
+}
+
+// mergeWithFileLib places the file with the SHA-256 hash at outputPath without saving its content
+// again if it was already downloaded from the FileLib, returning where its content is
+func (l *Looter) mergeWithFileLib(hash, outputPath string) (string, bool) {
+	existing, ok := l.fileLibHashes.Load(hash)
+	if !ok {
+		return "", false
+	}
+	existingPath := existing.(string)
+	if l.Layout != LayoutTree {
+		// The files/<ext>/ name only differs by method
+		return existingPath, true
+	}
+	if filepath.Clean(existingPath) == filepath.Clean(outputPath) {
+		return existingPath, true
+	}
+	if err := materialize(existingPath, outputPath, LinkHard); err != nil {
+		slog.Debug(fmt.Sprintf("Error linking %s to %s: %v", outputPath, existingPath, err))
+		return "", false
+	}
+	return outputPath, true
+}
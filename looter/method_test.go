@@ -0,0 +1,104 @@
+package looter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// combinedDP is a DP that allows both directory listing and signatures, with a package whose
+// signature lists setup.ps1 but not the sub/a.txt found in its listing, and a package ABC00003.1
+// without a signature
+type combinedDP struct {
+	mu sync.Mutex
+	// requests counts the requests by path
+	requests map[string]int
+}
+
+var (
+	combinedScript = []byte("net use Z: \\\\srv\\share Hunter2xyz /user:CORP\\svc\r\n")
+	combinedHash   = func() string {
+		sum := sha256.Sum256(combinedScript)
+		return strings.ToUpper(hex.EncodeToString(sum[:]))
+	}()
+)
+
+func (d *combinedDP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	d.requests[r.URL.EscapedPath()]++
+	d.mu.Unlock()
+
+	switch path := r.URL.EscapedPath(); path {
+	case "/SMS_DP_SMSSIG$/ABC00001.1.tar":
+		w.Write(signatureRecord(`Scripts\setup.ps1`, typeFile, rdcSignature(1, uint16(len(combinedScript)))))
+	case "/SMS_DP_SMSPKG$/Datalib/ABC00001.1/Scripts/setup.ps1.INI":
+		fmt.Fprintf(w, "[File]\r\nHash=%s\r\n", combinedHash)
+	case "/SMS_DP_SMSPKG$/FileLib/" + combinedHash[:4] + "/" + combinedHash, "/SMS_DP_SMSPKG$/ABC00001.1/Scripts%5Csetup.ps1":
+		w.Write(combinedScript)
+	case "/SMS_DP_SMSPKG$/ABC00001.1":
+		fmt.Fprintf(w, `<pre><A HREF="/">[To Parent Directory]</A><br><br> 1/2/2024  3:04 PM %8d <A HREF="/SMS_DP_SMSPKG$/ABC00001.1/Scripts%%5Csetup.ps1">Scripts\setup.ps1</A><br>`+
+			` 1/2/2024  3:04 PM        &lt;dir&gt; <A HREF="/SMS_DP_SMSPKG$/ABC00001.1/sub/">sub</A><br></pre>`, len(combinedScript))
+	case "/SMS_DP_SMSPKG$/ABC00001.1/sub/":
+		io.WriteString(w, `<pre><A HREF="/">[To Parent Directory]</A><br><br> 1/2/2024  3:04 PM        5 <A HREF="a.txt">a.txt</A><br></pre>`)
+	case "/SMS_DP_SMSPKG$/ABC00001.1/sub/a.txt":
+		io.WriteString(w, "hello")
+	case "/SMS_DP_SMSPKG$/ABC00003.1":
+		io.WriteString(w, `<pre><A HREF="/">[To Parent Directory]</A><br><br> 1/2/2024  3:04 PM        5 <A HREF="/SMS_DP_SMSPKG$/ABC00003.1/b.txt">b.txt</A><br></pre>`)
+	case "/SMS_DP_SMSPKG$/ABC00003.1/b.txt":
+		io.WriteString(w, "world")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDownloadCombined(t *testing.T) {
+	dp := &combinedDP{requests: make(map[string]int)}
+	ts := httptest.NewServer(dp)
+	defer ts.Close()
+
+	for _, layout := range []string{LayoutExtension, LayoutTree} {
+		t.Run(layout, func(t *testing.T) {
+			dp.requests = make(map[string]int)
+			outputDir := t.TempDir()
+			l, err := New(ts.URL, ts.Client(), Options{OutputDir: outputDir, AllowExtensions: []string{"all"}, Layout: layout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			l.DownloadCombined([]string{"ABC00001.1", "ABC00001.1.INI", "ABC00003.1"})
+
+			var saved []string
+			filepath.WalkDir(filepath.Join(outputDir, "files"), func(path string, entry os.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					content, _ := os.ReadFile(path)
+					saved = append(saved, fmt.Sprintf("%s=%s", filepath.Base(path), content))
+				}
+				return nil
+			})
+			// The files only in the listings are downloaded, the one in the signature only from the FileLib
+			if len(saved) != 3 || !strings.Contains(strings.Join(saved, "\n"), "a.txt=hello") {
+				t.Errorf("saved %q, want setup.ps1, a.txt and b.txt", saved)
+			}
+			if n := dp.requests["/SMS_DP_SMSPKG$/ABC00001.1/Scripts%5Csetup.ps1"]; n != 0 {
+				t.Errorf("setup.ps1 was downloaded %d times from the listing", n)
+			}
+			// setup.ps1 is enumerated once and skipped in the listing, and the listing of ABC00003.1
+			// makes up for its missing signature
+			report := l.Report(nil)
+			if want := (FileSummary{Enumerated: 3, Downloaded: 3, Skipped: 1, Verified: 1}); report.Files != want {
+				t.Errorf("Report().Files = %+v, want %+v", report.Files, want)
+			}
+			if report.Outcome != OutcomeComplete {
+				t.Errorf("Report().Outcome = %s, want complete (failures %+v)", report.Outcome, report.Failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package looter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PlanFileName is the name of the plan saved in the output directory of a DP
+const PlanFileName = "plan.json"
+
+// Plan is the list of files a run would download from a DP, with what it would cost
+type Plan struct {
+	BaseURL string `json:"base_url"`
+	// Method is how the files were found, "sig" (signatures) or "url" (directory listings)
+	Method  string        `json:"method"`
+	Created time.Time     `json:"created"`
+	Files   []PlannedFile `json:"files"`
+	// Extensions is the number of files per extension, "UKN" for files without one
+	Extensions map[string]int `json:"extensions"`
+	// EstimatedBytes is the total size of the files of known size
+	EstimatedBytes int64 `json:"estimated_bytes"`
+	// UnknownSizes is the number of files not counted in EstimatedBytes
+	UnknownSizes int `json:"unknown_sizes"`
+	// EnumerationRequests is the number of requests made to build the plan
+	EnumerationRequests int64 `json:"enumeration_requests"`
+	// DownloadRequests is the number of requests needed to download the files
+	DownloadRequests int64 `json:"download_requests"`
+}
+
+// PlannedFile is a file in a Plan
+type PlannedFile struct {
+	ContentID string `json:"content_id"`
+	// Path is the relative path of the file in its package
+	Path string `json:"path"`
+	// URL is the URL of the file for the "url" method
+	URL string `json:"url,omitempty"`
+	// Size is the size from the directory listing or the RDC signature, -1 if unknown
+	Size int64 `json:"size"`
+}
+
+// PlanSignatures returns the plan for downloading the wanted files listed in the signatures at signaturePaths
+func (l *Looter) PlanSignatures(signaturePaths []string) (*Plan, error) {
+	l.stats.setMethod(methodSignature)
+	plan := &Plan{BaseURL: l.BaseURL, Method: methodSignature}
+	for _, signaturePath := range signaturePaths {
+		entries, err := ParseSignatureFile(signaturePath)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing signature %s: %w", signaturePath, err)
+		}
+		contentID := signatureContentID(signaturePath)
+		filtered := 0
+		for _, entry := range entries {
+			if !l.fileWanted(entry.Path) {
+				filtered++
+				continue
+			}
+			plan.Files = append(plan.Files, PlannedFile{ContentID: contentID, Path: entry.Path, Size: entry.Size})
+		}
+		l.countEnumerated(len(entries), filtered)
+	}
+	// Every file needs its INI then the file from the FileLib
+	plan.finish(l, 2)
+	return plan, nil
+}
+
+// PlanURLs returns the plan for downloading the wanted files from fileURLs
+func (l *Looter) PlanURLs(fileURLs []string) *Plan {
+	l.stats.setMethod(methodURL)
+	plan := &Plan{BaseURL: l.BaseURL, Method: methodURL}
+	wanted, _ := l.wantedURLs(fileURLs)
+	for _, fileURL := range wanted {
+		contentID, relativePath := contentPathFromURL(fileURL)
+		file := PlannedFile{ContentID: contentID, Path: relativePath, URL: fileURL, Size: -1}
+		if size, ok := l.listedSizes.Load(fileURL); ok {
+			file.Size = size.(int64)
+		}
+		plan.Files = append(plan.Files, file)
+	}
+	plan.finish(l, 1)
+	return plan
+}
+
+// finish fills in the totals of the plan, for files needing requestsPerFile requests each
+func (p *Plan) finish(l *Looter, requestsPerFile int64) {
+	p.Created = time.Now()
+	p.Extensions = map[string]int{}
+	for _, file := range p.Files {
+		extension := strings.TrimPrefix(path.Ext(file.Path), ".")
+		if extension == "" {
+			extension = "UKN"
+		}
+		p.Extensions[extension]++
+		if file.Size < 0 {
+			p.UnknownSizes++
+		} else {
+			p.EstimatedBytes += file.Size
+		}
+	}
+	p.EnumerationRequests = l.Requests()
+	p.DownloadRequests = requestsPerFile * int64(len(p.Files))
+}
+
+// Summary returns a human readable description of the plan
+func (p *Plan) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d files to download from %s with %d requests (%d requests made to enumerate)\n", len(p.Files), p.BaseURL, p.DownloadRequests, p.EnumerationRequests)
+	fmt.Fprintf(&b, "Estimated size: %d bytes", p.EstimatedBytes)
+	if p.UnknownSizes > 0 {
+		fmt.Fprintf(&b, " (plus %d files of unknown size)", p.UnknownSizes)
+	}
+	b.WriteString("\n")
+
+	extensions := make([]string, 0, len(p.Extensions))
+	for extension := range p.Extensions {
+		extensions = append(extensions, extension)
+	}
+	sort.Slice(extensions, func(i, j int) bool {
+		if p.Extensions[extensions[i]] != p.Extensions[extensions[j]] {
+			return p.Extensions[extensions[i]] > p.Extensions[extensions[j]]
+		}
+		return extensions[i] < extensions[j]
+	})
+	for _, extension := range extensions {
+		fmt.Fprintf(&b, "  %-10s %d\n", extension, p.Extensions[extension])
+	}
+	return b.String()
+}
+
+// Save writes the plan to filePath as JSON
+func (p *Plan) Save(filePath string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// LoadPlan reads a plan saved with Save
+func LoadPlan(filePath string) (*Plan, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", filePath, err)
+	}
+	return &plan, nil
+}
+
+// ExecutePlan downloads exactly the files of plan, which must have been made for this DP
+func (l *Looter) ExecutePlan(plan *Plan) error {
+	if plan.BaseURL != l.BaseURL {
+		return fmt.Errorf("plan is for %s, not %s", plan.BaseURL, l.BaseURL)
+	}
+	if err := os.MkdirAll(l.OutputDir, os.ModePerm); err != nil {
+		return err
+	}
+	l.stats.setMethod(plan.Method)
+	l.countEnumerated(len(plan.Files), 0)
+
+	switch plan.Method {
+	case methodSignature:
+		// Keep the order of the packages in the plan
+		var contentIDs []string
+		packages := map[string][]string{}
+		for _, file := range plan.Files {
+			if _, ok := packages[file.ContentID]; !ok {
+				contentIDs = append(contentIDs, file.ContentID)
+			}
+			packages[file.ContentID] = append(packages[file.ContentID], file.Path)
+		}
+		bar, stop := l.newProgressBar(len(contentIDs), "[cyan][1/1][reset] Getting files...")
+		defer stop()
+		for _, contentID := range contentIDs {
+			bar.Add(1)
+			l.downloadPackage(contentID, packages[contentID])
+		}
+		bar.Finish()
+	case methodURL:
+		fileURLs := make([]string, 0, len(plan.Files))
+		for _, file := range plan.Files {
+			fileURLs = append(fileURLs, file.URL)
+		}
+		l.downloadURLs(fileURLs)
+	default:
+		return fmt.Errorf("unknown plan method: %s", plan.Method)
+	}
+	return nil
+}
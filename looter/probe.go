@@ -0,0 +1,325 @@
+package looter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"sccm-http-looter/ntlm"
+)
+
+// ProbeFileName is the name of the probe result saved in the output directory of a DP
+const ProbeFileName = "probe.json"
+
+// maxProbeBody caps how much of a response body is read while probing
+const maxProbeBody = 64 << 20
+
+// ProbeStatus is whether a DP has a capability
+type ProbeStatus string
+
+const (
+	ProbeYes ProbeStatus = "yes"
+	ProbeNo  ProbeStatus = "no"
+	// ProbeUntested is a capability that could not be tested, i.e. FileLib access without an INI to get a hash from
+	ProbeUntested ProbeStatus = "untested"
+)
+
+// contentPrefixes are the prefixes of the other virtual directories a DP can serve its content
+// from: NOCERT_ for clients without a PKI certificate and CCMTOKENAUTH_ for Enhanced HTTP
+var contentPrefixes = []string{"NOCERT_", "CCMTOKENAUTH_"}
+
+// ProbeCheck is a single request sent while probing and what it showed
+type ProbeCheck struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Status is the HTTP status code, 0 if no response was received
+	Status int `json:"status"`
+	// Location is where a redirect points to
+	Location string      `json:"location,omitempty"`
+	Result   ProbeStatus `json:"result"`
+	Detail   string      `json:"detail,omitempty"`
+}
+
+// ProbeResult is what a DP allows, found without looting it
+type ProbeResult struct {
+	Target string    `json:"target"`
+	Time   time.Time `json:"time"`
+	// Anonymous is whether the Datalib can be read without credentials
+	Anonymous ProbeStatus `json:"anonymous"`
+	// Authenticated is whether the Datalib can be read with the credentials, untested without credentials
+	Authenticated ProbeStatus `json:"authenticated"`
+	// AuthSchemes are the schemes offered in WWW-Authenticate when the DP asks for credentials
+	AuthSchemes []string `json:"auth_schemes,omitempty"`
+	// Browsing is directory browsing of the Datalib
+	Browsing ProbeStatus `json:"directory_browsing"`
+	// PackageListing is directory browsing of the packages, which the URL method needs
+	PackageListing ProbeStatus `json:"package_listing"`
+	Signatures     ProbeStatus `json:"signatures"`
+	// FileLib is direct access to FileLib content by hash, which the signature method needs
+	FileLib      ProbeStatus `json:"filelib"`
+	NoCert       ProbeStatus `json:"nocert"`
+	CCMTokenAuth ProbeStatus `json:"ccmtokenauth"`
+	// HTTP and HTTPS are whether the DP serves its content over each protocol, without following redirects
+	HTTP  ProbeStatus `json:"http"`
+	HTTPS ProbeStatus `json:"https"`
+	// HTTPRedirect is where HTTP requests are redirected to, if they are
+	HTTPRedirect string `json:"http_redirect,omitempty"`
+	// NTLM is what the DP disclosed in its NTLM challenge, if it asked for Windows authentication
+	NTLM *ntlm.ServerInfo `json:"ntlm,omitempty"`
+	// Methods are the -method values that will work, empty if none does
+	Methods []string `json:"methods"`
+	// Checks are all the requests sent, in order
+	Checks []ProbeCheck `json:"checks"`
+}
+
+// Probe tests what the DP allows without downloading any file: anonymous and authenticated access to the
+// Datalib, directory browsing, signatures, FileLib access, the NOCERT_ and CCMTOKENAUTH_ virtual
+// directories, HTTP and HTTPS. anonymous is a client without credentials, which can be the Looter's Client.
+func (l *Looter) Probe(anonymous *http.Client) *ProbeResult {
+	result := &ProbeResult{
+		Target:         l.BaseURL,
+		Time:           time.Now(),
+		Authenticated:  ProbeUntested,
+		Browsing:       ProbeUntested,
+		PackageListing: ProbeUntested,
+		Signatures:     ProbeUntested,
+		FileLib:        ProbeUntested,
+		Methods:        []string{},
+	}
+
+	// Access to the Datalib, which every method starts with
+	datalibURL := fmt.Sprintf("%s/SMS_DP_SMSPKG$/Datalib", l.BaseURL)
+	check, header, datalib := l.probeURL(anonymous, "anonymous_datalib", datalibURL, true)
+	result.add(check)
+	result.Anonymous = check.Result
+	if check.Status == http.StatusUnauthorized {
+		// The 401 also got the NTLM challenge of the DP decoded, if it offers NTLM
+		result.AuthSchemes = offeredSchemes(header.Values("WWW-Authenticate"))
+	}
+	if l.Client != anonymous {
+		check, _, body := l.probeURL(l.Client, "authenticated_datalib", datalibURL, true)
+		result.add(check)
+		result.Authenticated = check.Result
+		if result.Anonymous != ProbeYes {
+			datalib = body
+		}
+	}
+
+	if result.Anonymous == ProbeYes || result.Authenticated == ProbeYes {
+		var contentIDs []string
+		for _, name := range ParseDatalib(string(datalib)) {
+			if name != "" && !strings.HasSuffix(name, ".INI") && len(contentIDs) < probeCount {
+				contentIDs = append(contentIDs, name)
+			}
+		}
+		result.Browsing = ProbeNo
+		if len(contentIDs) > 0 {
+			result.Browsing = ProbeYes
+			l.probeContent(result, contentIDs)
+		}
+	}
+
+	for _, prefix := range contentPrefixes {
+		name := strings.ToLower(prefix) + "datalib"
+		check, _, _ := l.probeURL(l.Client, name, fmt.Sprintf("%s/%sSMS_DP_SMSPKG$/Datalib", l.BaseURL, prefix), false)
+		result.add(check)
+		if prefix == "NOCERT_" {
+			result.NoCert = check.Result
+		} else {
+			result.CCMTokenAuth = check.Result
+		}
+	}
+
+	l.probeProtocols(result, anonymous)
+	result.NTLM = l.NTLMInfo()
+
+	if result.PackageListing == ProbeYes {
+		result.Methods = append(result.Methods, methodURL)
+	}
+	if result.Signatures == ProbeYes && result.FileLib != ProbeNo {
+		result.Methods = append(result.Methods, methodSignature)
+	}
+	return result
+}
+
+// probeContent tests directory browsing and signatures on a few packages, then FileLib access
+// through the hash in the INI of one of their files
+func (l *Looter) probeContent(result *ProbeResult, contentIDs []string) {
+	var iniURL string
+	result.PackageListing = ProbeNo
+	for _, contentID := range contentIDs {
+		check, _, _ := l.probeURL(l.Client, "package_listing", fmt.Sprintf("%s/SMS_DP_SMSPKG$/%s", l.BaseURL, contentID), false)
+		result.add(check)
+		if check.Result == ProbeYes {
+			result.PackageListing = ProbeYes
+			// The INIs of a package are listed in its Datalib directory
+			iniURL = l.probeINIFromListing(result, contentID)
+			break
+		}
+	}
+
+	result.Signatures = ProbeNo
+	for _, contentID := range contentIDs {
+		check, _, body := l.probeURL(l.Client, "signature", fmt.Sprintf("%s/SMS_DP_SMSSIG$/%s.tar", l.BaseURL, contentID), true)
+		if check.Result == ProbeYes {
+			entries, err := ParseSignature(body)
+			if err != nil || len(entries) == 0 {
+				check.Result = ProbeNo
+				check.Detail = "not a valid signature"
+			} else {
+				check.Detail = fmt.Sprintf("%d files", len(entries))
+				result.Signatures = ProbeYes
+				if iniURL == "" {
+					iniURL = fmt.Sprintf("%s/SMS_DP_SMSPKG$/Datalib/%s/%s.INI", l.BaseURL, contentID, entries[0].Path)
+				}
+			}
+		}
+		result.add(check)
+		if result.Signatures == ProbeYes {
+			break
+		}
+	}
+
+	if iniURL == "" {
+		return
+	}
+	check, _, body := l.probeURL(l.Client, "ini", iniURL, true)
+	var info iniFile
+	if check.Result == ProbeYes {
+		var err error
+		if info, err = getFileInfoFromINI(body); err != nil {
+			check.Result = ProbeNo
+			check.Detail = err.Error()
+		} else {
+			check.Detail = "hash " + info.Hash
+		}
+	}
+	result.add(check)
+	if check.Result != ProbeYes {
+		return
+	}
+	check, _, _ = l.probeURL(l.Client, "filelib", fmt.Sprintf("%s/SMS_DP_SMSPKG$/FileLib/%s/%s", l.BaseURL, info.Hash[0:4], info.Hash), false)
+	result.add(check)
+	result.FileLib = check.Result
+}
+
+// probeINIFromListing returns the URL of an INI in the Datalib directory of contentID, empty if there is none
+func (l *Looter) probeINIFromListing(result *ProbeResult, contentID string) string {
+	listingURL := fmt.Sprintf("%s/SMS_DP_SMSPKG$/Datalib/%s", l.BaseURL, contentID)
+	check, _, body := l.probeURL(l.Client, "ini_listing", listingURL, true)
+	result.add(check)
+	if check.Result != ProbeYes {
+		return ""
+	}
+	for _, entry := range ParseListing(string(body), listingURL) {
+		if !entry.IsDir && strings.HasSuffix(strings.ToUpper(entry.Name), ".INI") {
+			return entry.URL
+		}
+	}
+	return ""
+}
+
+// probeProtocols tests whether the DP serves its content over HTTP and HTTPS, and whether HTTP
+// requests are redirected
+func (l *Looter) probeProtocols(result *ProbeResult, anonymous *http.Client) {
+	u, err := url.Parse(l.BaseURL)
+	if err != nil {
+		return
+	}
+	noRedirect := *anonymous
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	for _, scheme := range []string{"http", "https"} {
+		base := l.BaseURL
+		if u.Scheme != scheme {
+			// The other protocol on its default port
+			port := "80"
+			if scheme == "https" {
+				port = "443"
+			}
+			base = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(u.Hostname(), port))
+		}
+		check, _, _ := l.probeURL(&noRedirect, scheme, base+"/SMS_DP_SMSPKG$/Datalib", false)
+		switch {
+		case check.Status == http.StatusUnauthorized:
+			// Served, with credentials
+			check.Result = ProbeYes
+		case check.Location != "":
+			check.Detail = "redirects to " + check.Location
+		case check.Status == http.StatusForbidden && scheme == "http":
+			check.Detail = "forbidden, HTTPS may be required"
+		}
+		result.add(check)
+		if scheme == "http" {
+			result.HTTP = check.Result
+			result.HTTPRedirect = check.Location
+		} else {
+			result.HTTPS = check.Result
+		}
+	}
+}
+
+// probeURL sends a single GET request for url with client, reading the body if readBody is set.
+// The check is ProbeYes for a 200 response.
+func (l *Looter) probeURL(client *http.Client, name, url string, readBody bool) (ProbeCheck, http.Header, []byte) {
+	check := ProbeCheck{Name: name, URL: url, Result: ProbeNo}
+	response, err := l.getWith(client, url)
+	if err != nil {
+		check.Detail = err.Error()
+		slog.Debug(fmt.Sprintf("Probe %s: %v", url, err))
+		return check, nil, nil
+	}
+	defer response.Body.Close()
+
+	check.Status = response.StatusCode
+	check.Location = response.Header.Get("Location")
+	slog.Debug(fmt.Sprintf("Probe %s: %d", url, response.StatusCode))
+	if response.StatusCode != http.StatusOK {
+		return check, response.Header, nil
+	}
+	check.Result = ProbeYes
+	if !readBody {
+		return check, response.Header, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxProbeBody))
+	if err != nil {
+		check.Result = ProbeNo
+		check.Detail = err.Error()
+		return check, response.Header, nil
+	}
+	return check, response.Header, body
+}
+
+func (r *ProbeResult) add(check ProbeCheck) {
+	r.Checks = append(r.Checks, check)
+}
+
+// offeredSchemes returns the names of the schemes in WWW-Authenticate headers, i.e. NTLM and Negotiate
+func offeredSchemes(wwwAuthenticate []string) []string {
+	var schemes []string
+	for _, header := range wwwAuthenticate {
+		name, _, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if name != "" {
+			schemes = append(schemes, name)
+		}
+	}
+	return schemes
+}
+
+// Save writes the probe result to filePath as JSON
+func (r *ProbeResult) Save(filePath string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
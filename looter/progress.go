@@ -0,0 +1,54 @@
+package looter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/k0kubun/go-ansi"
+	"github.com/schollz/progressbar/v3"
+)
+
+// newProgressBar returns the progress bar used for every looting stage, use max -1 for an unknown total.
+// stop must be called once the stage is over, finished or not, to release the bar.
+func (l *Looter) newProgressBar(max int, description string) (bar *progressbar.ProgressBar, stop func()) {
+	bar = progressbar.NewOptions(max,
+		progressbar.OptionSetVisibility(!l.HideProgress),
+		progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(false),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowElapsedTimeOnFinish(),
+		progressbar.OptionSetWidth(30),
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}))
+
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() { once.Do(func() { close(done) }) }
+
+	// Show the current rate limits, which change in adaptive mode
+	if state := l.rateState(); state != "" && !l.HideProgress {
+		bar.Describe(description + " " + state)
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if !bar.IsFinished() {
+						bar.Describe(description + " " + l.rateState())
+					}
+				}
+			}
+		}()
+	}
+	return bar, stop
+}
@@ -0,0 +1,75 @@
+package looter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// setProxy routes every connection of transport through the proxy at proxyURL: http:// or
+// https:// for an HTTP proxy, socks5:// to resolve DP names locally or socks5h:// to have the
+// SOCKS server resolve them. Credentials can be given as user:pass@ in the URL.
+func setProxy(transport *http.Transport, proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy URL: %s", proxyURL)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		// net/http sends the credentials of the URL as Proxy-Authorization
+		transport.Proxy = http.ProxyURL(u)
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(u, &net.Dialer{})
+		if err != nil {
+			return err
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return fmt.Errorf("proxy %s does not support contexts", proxyURL)
+		}
+		dial := contextDialer.DialContext
+		if u.Scheme == "socks5" {
+			dial = resolveLocally(dial)
+		}
+		transport.Proxy = nil
+		transport.DialContext = dial
+	default:
+		return fmt.Errorf("unsupported proxy scheme: %s (use http, https, socks5 or socks5h)", u.Scheme)
+	}
+	return nil
+}
+
+// resolveLocally wraps dial so host names are resolved before being sent to the proxy, which
+// otherwise resolves them itself
+func resolveLocally(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		err = fmt.Errorf("no address for %s", host)
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = dial(ctx, network, net.JoinHostPort(addr.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,302 @@
+package looter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// socksServer is a minimal SOCKS5 proxy (RFC 1928 and RFC 1929) recording the destinations it is
+// asked to connect to. Host names are resolved through hosts, so names that only the proxy knows
+// can be tested.
+type socksServer struct {
+	listener net.Listener
+	// user and password are required when user is set
+	user, password string
+	hosts          map[string]string
+
+	mu sync.Mutex
+	// destinations are the host:port of every CONNECT request, as sent by the client
+	destinations []string
+}
+
+func newSOCKSServer(t *testing.T, hosts map[string]string) *socksServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{listener: listener, hosts: hosts}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksServer) url(scheme string) string {
+	if s.user != "" {
+		return fmt.Sprintf("%s://%s:%s@%s", scheme, s.user, s.password, s.listener.Addr())
+	}
+	return fmt.Sprintf("%s://%s", scheme, s.listener.Addr())
+}
+
+func (s *socksServer) requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.destinations...)
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := s.authenticate(conn); err != nil {
+		return
+	}
+
+	// VER CMD RSV ATYP, then the address and port
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil || request[1] != 1 {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	case 4:
+		ip := make([]byte, net.IPv6len)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	destination := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	s.mu.Lock()
+	s.destinations = append(s.destinations, destination)
+	s.mu.Unlock()
+
+	if resolved, ok := s.hosts[host]; ok {
+		host = resolved
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		// Host unreachable
+		conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(target, conn); done <- struct{}{} }()
+	go func() { io.Copy(conn, target); done <- struct{}{} }()
+	<-done
+}
+
+// authenticate negotiates no authentication, or username/password authentication if s.user is set
+func (s *socksServer) authenticate(conn net.Conn) error {
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil || greeting[0] != 5 {
+		return errors.New("not SOCKS5")
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	if s.user == "" {
+		_, err := conn.Write([]byte{5, 0})
+		return err
+	}
+	if !strings.Contains(string(methods), "\x02") {
+		conn.Write([]byte{5, 0xff})
+		return errors.New("no acceptable method")
+	}
+	conn.Write([]byte{5, 2})
+
+	// VER ULEN UNAME PLEN PASSWD
+	header := make([]byte, 2)
+	io.ReadFull(conn, header)
+	user := make([]byte, header[1])
+	io.ReadFull(conn, user)
+	length := make([]byte, 1)
+	io.ReadFull(conn, length)
+	password := make([]byte, length[0])
+	io.ReadFull(conn, password)
+	if string(user) != s.user || string(password) != s.password {
+		conn.Write([]byte{1, 1})
+		return errors.New("invalid credentials")
+	}
+	_, err := conn.Write([]byte{1, 0})
+	return err
+}
+
+// dpPort returns the port of the test server at serverURL
+func dpPort(t *testing.T, serverURL string) string {
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func TestSOCKSProxy(t *testing.T) {
+	ts := httptest.NewServer(datalibHandler)
+	defer ts.Close()
+	port := dpPort(t, ts.URL)
+
+	tests := []struct {
+		name   string
+		scheme string
+		// host is the DP name in the request
+		host string
+		// remote is whether the proxy should be asked for host rather than an IP address
+		remote bool
+	}{
+		// The .invalid name only resolves on the proxy side
+		{"remote DNS", "socks5h", "sccm01.corp.invalid", true},
+		{"local DNS", "socks5", "localhost", false},
+		{"IP address", "socks5", "127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := newSOCKSServer(t, map[string]string{"sccm01.corp.invalid": "127.0.0.1"})
+			client, err := NewHTTPClient(ClientConfig{Timeout: 5 * time.Second, Proxy: proxy.url(tt.scheme)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get(fmt.Sprintf("http://%s/SMS_DP_SMSPKG$/Datalib", net.JoinHostPort(tt.host, port)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !strings.Contains(string(body), "ABC00001.1") {
+				t.Errorf("body = %q", body)
+			}
+
+			// localhost may resolve to ::1 first, which the proxy fails to reach before 127.0.0.1
+			requested := proxy.requested()
+			if len(requested) == 0 {
+				t.Fatal("the request did not go through the proxy")
+			}
+			for _, destination := range requested {
+				host, _, _ := net.SplitHostPort(destination)
+				if remote := net.ParseIP(host) == nil; remote != tt.remote || (remote && host != tt.host) {
+					t.Errorf("proxy was asked for %s", destination)
+				}
+			}
+		})
+	}
+
+	// With socks5://, a name only the proxy knows cannot be resolved
+	proxy := newSOCKSServer(t, map[string]string{"sccm01.corp.invalid": "127.0.0.1"})
+	client, err := NewHTTPClient(ClientConfig{Timeout: 5 * time.Second, Proxy: proxy.url("socks5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(fmt.Sprintf("http://%s/", net.JoinHostPort("sccm01.corp.invalid", port))); err == nil {
+		t.Error("socks5:// reached a name that only resolves on the proxy")
+	}
+	if requested := proxy.requested(); len(requested) != 0 {
+		t.Errorf("socks5:// sent %v to the proxy", requested)
+	}
+}
+
+func TestSOCKSProxyCredentials(t *testing.T) {
+	ts := httptest.NewServer(datalibHandler)
+	defer ts.Close()
+
+	proxy := newSOCKSServer(t, nil)
+	proxy.user, proxy.password = "pivot", "s3cret"
+	client, err := NewHTTPClient(ClientConfig{Timeout: 5 * time.Second, Proxy: proxy.url("socks5h")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ts.URL + "/SMS_DP_SMSPKG$/Datalib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(proxy.requested()) != 1 {
+		t.Errorf("status %d through the proxy, %d connections", resp.StatusCode, len(proxy.requested()))
+	}
+
+	wrong, err := NewHTTPClient(ClientConfig{Timeout: 5 * time.Second, Proxy: strings.Replace(proxy.url("socks5h"), ":s3cret@", ":wrong@", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Get(ts.URL + "/SMS_DP_SMSPKG$/Datalib"); err == nil {
+		t.Error("request succeeded with wrong proxy credentials")
+	}
+}
+
+func TestSOCKSProxyNTLM(t *testing.T) {
+	server := newNTLMServer("NTLM")
+	ts := httptest.NewServer(server.wrap(datalibHandler))
+	defer ts.Close()
+
+	proxy := newSOCKSServer(t, map[string]string{"sccm01.corp.invalid": "127.0.0.1"})
+	target := "http://" + net.JoinHostPort("sccm01.corp.invalid", dpPort(t, ts.URL))
+	client, err := NewHTTPClient(ClientConfig{
+		Timeout:     5 * time.Second,
+		Proxy:       proxy.url("socks5h"),
+		Credentials: &Credentials{Username: testUser, Domain: testDomain, Password: testPassword, Targets: []string{target}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(target, client, Options{OutputDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.ListDatalib(); err != nil {
+		t.Fatalf("ListDatalib() error: %v", err)
+	}
+
+	// The anonymous request, then the negotiate and authenticate messages on one connection
+	requested := proxy.requested()
+	if len(requested) != 2 || server.handshakes.Load() != 1 {
+		t.Errorf("proxy got %v for %d handshakes, want 2 connections for 1 handshake", requested, server.handshakes.Load())
+	}
+	for _, destination := range requested {
+		if !strings.HasPrefix(destination, "sccm01.corp.invalid:") {
+			t.Errorf("proxy was asked for %s", destination)
+		}
+	}
+}
+
+func TestSetProxyInvalid(t *testing.T) {
+	for _, proxyURL := range []string{"ftp://proxy:21", "socks4://proxy:1080", "proxy:3128", "http://"} {
+		if err := setProxy(&http.Transport{}, proxyURL); err == nil {
+			t.Errorf("setProxy(%q) succeeded", proxyURL)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package looter
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Adaptive rate limiting lowers the request rate by half when the DP answers 429 or 503 and by a
+// quarter when its latency climbs, at most once per adaptiveCooldown and down to a twentieth of the
+// maximum rate. Each response that does not show an overload raises the rate by adaptiveStep of the
+// maximum, up to the maximum.
+const (
+	adaptiveCooldown = time.Second
+	adaptiveStep     = 0.05
+	adaptiveMinRatio = 0.05
+	// adaptiveSlowdown is how much slower than the fastest average latency counts as overloaded
+	adaptiveSlowdown = 3
+	// adaptiveWarmup is the number of requests before the latency is trusted
+	adaptiveWarmup = 5
+)
+
+// tokenBucket allows rate tokens per second with bursts of up to one second of tokens
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: max(rate, 1), last: time.Now()}
+}
+
+// refill adds the tokens earned since the last call, the caller holds mu
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(max(b.rate, 1), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait takes n tokens, blocking until they are earned. Tokens are taken right away so
+// concurrent callers queue up in order.
+func (b *tokenBucket) wait(n float64) {
+	b.mu.Lock()
+	b.refill()
+	b.tokens -= n
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	time.Sleep(delay)
+}
+
+func (b *tokenBucket) setRate(rate float64) {
+	b.mu.Lock()
+	b.refill()
+	b.rate = rate
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) currentRate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+// RateLimit limits the requests and bytes per second sent to DPs, either to a single DP or, when
+// it is shared by several Looters, to all of them. A nil RateLimit has no limit.
+type RateLimit struct {
+	requests *tokenBucket
+	bytes    *tokenBucket
+
+	// adaptive scales the request rate between adaptiveMinRatio and 1 of maxRate
+	adaptive     bool
+	maxRate      float64
+	mu           sync.Mutex
+	samples      int
+	latency      time.Duration
+	fastest      time.Duration
+	lastDecrease time.Time
+}
+
+// NewRateLimit returns a RateLimit allowing requestsPerSecond requests and bytesPerSecond bytes,
+// 0 for no limit, or nil if there is no limit at all. With adaptive, the request rate is lowered
+// when the DP slows down or answers 429 or 503, then raised back up to requestsPerSecond.
+func NewRateLimit(requestsPerSecond float64, bytesPerSecond int64, adaptive bool) *RateLimit {
+	if requestsPerSecond <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+	r := &RateLimit{}
+	if requestsPerSecond > 0 {
+		r.requests = newTokenBucket(requestsPerSecond)
+		r.adaptive = adaptive
+		r.maxRate = requestsPerSecond
+	}
+	if bytesPerSecond > 0 {
+		r.bytes = newTokenBucket(float64(bytesPerSecond))
+	}
+	return r
+}
+
+// waitRequest blocks until a request is allowed
+func (r *RateLimit) waitRequest() {
+	if r == nil || r.requests == nil {
+		return
+	}
+	r.requests.wait(1)
+}
+
+// waitBytes blocks until n more bytes are allowed
+func (r *RateLimit) waitBytes(n int) {
+	if r == nil || r.bytes == nil || n <= 0 {
+		return
+	}
+	r.bytes.wait(float64(n))
+}
+
+// observe adapts the request rate to a response received after latency, with statusCode (0 for an error)
+func (r *RateLimit) observe(latency time.Duration, statusCode int) {
+	if r == nil || !r.adaptive {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	overloaded := statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+	factor := 0.5
+	if !overloaded && statusCode != 0 {
+		// Moving average of the latency, compared with the fastest average seen
+		r.samples++
+		if r.latency == 0 {
+			r.latency = latency
+		} else {
+			r.latency = (4*r.latency + latency) / 5
+		}
+		if r.samples >= adaptiveWarmup && (r.fastest == 0 || r.latency < r.fastest) {
+			r.fastest = r.latency
+		}
+		overloaded = r.fastest > 0 && r.latency > adaptiveSlowdown*r.fastest
+		factor = 0.75
+	}
+
+	rate := r.requests.currentRate()
+	switch {
+	case overloaded && time.Since(r.lastDecrease) >= adaptiveCooldown:
+		rate = max(rate*factor, r.maxRate*adaptiveMinRatio)
+		r.lastDecrease = time.Now()
+		slog.Debug(fmt.Sprintf("DP overloaded (status %d, latency %v), lowering the rate to %.1f requests/s", statusCode, r.latency.Round(time.Millisecond), rate))
+	case !overloaded && statusCode != 0:
+		rate = min(rate+r.maxRate*adaptiveStep, r.maxRate)
+	default:
+		return
+	}
+	r.requests.setRate(rate)
+}
+
+// State describes the current limits, i.e. for the progress output
+func (r *RateLimit) State() string {
+	if r == nil {
+		return ""
+	}
+	var parts []string
+	if r.requests != nil {
+		if r.adaptive {
+			parts = append(parts, fmt.Sprintf("%.1f/%.1f req/s", r.requests.currentRate(), r.maxRate))
+		} else {
+			parts = append(parts, fmt.Sprintf("%.1f req/s", r.maxRate))
+		}
+	}
+	if r.bytes != nil {
+		parts = append(parts, formatBytes(int64(r.bytes.currentRate()))+"/s")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes formats n with a binary unit, i.e. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// rateLimits returns the limits that apply to this DP
+func (l *Looter) rateLimits() []*RateLimit {
+	var limits []*RateLimit
+	for _, r := range []*RateLimit{l.rate, l.GlobalRate} {
+		if r != nil {
+			limits = append(limits, r)
+		}
+	}
+	return limits
+}
+
+// rateState describes the limits of this DP for the progress output, empty if there are none
+func (l *Looter) rateState() string {
+	var parts []string
+	if state := l.rate.State(); state != "" {
+		parts = append(parts, "DP "+state)
+	}
+	if state := l.GlobalRate.State(); state != "" {
+		parts = append(parts, "global "+state)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, "; ") + "]"
+}
@@ -0,0 +1,97 @@
+package looter
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRateLimitObserve(t *testing.T) {
+	r := NewRateLimit(20, 0, true)
+
+	// A 503 halves the rate, once per cooldown
+	r.observe(10*time.Millisecond, http.StatusServiceUnavailable)
+	r.observe(10*time.Millisecond, http.StatusTooManyRequests)
+	if rate := r.requests.currentRate(); rate != 10 {
+		t.Fatalf("rate = %v after two overloads within the cooldown, want 10", rate)
+	}
+
+	// Each response without an overload raises the rate by a twentieth of the maximum
+	for i, want := range []float64{11, 12, 13} {
+		r.observe(10*time.Millisecond, http.StatusOK)
+		if rate := r.requests.currentRate(); rate != want {
+			t.Errorf("rate = %v after %d responses, want %v", rate, i+1, want)
+		}
+	}
+	// Errors without a response change nothing
+	r.observe(0, 0)
+	if rate := r.requests.currentRate(); rate != 13 {
+		t.Errorf("rate = %v after an error, want 13", rate)
+	}
+	for range 20 {
+		r.observe(10*time.Millisecond, http.StatusOK)
+	}
+	if rate := r.requests.currentRate(); rate != 20 {
+		t.Errorf("rate = %v, want the maximum of 20", rate)
+	}
+
+	// Latency three times the fastest average counts as an overload, lowering the rate by a quarter
+	r.lastDecrease = time.Time{}
+	for range 30 {
+		r.observe(time.Second, http.StatusOK)
+		if r.requests.currentRate() < 20 {
+			break
+		}
+	}
+	if rate := r.requests.currentRate(); rate != 15 {
+		t.Errorf("rate = %v after the latency climbed, want 15", rate)
+	}
+
+	// The rate never goes below a twentieth of the maximum
+	for range 10 {
+		r.lastDecrease = time.Time{}
+		r.observe(0, http.StatusServiceUnavailable)
+	}
+	if rate := r.requests.currentRate(); rate != 1 {
+		t.Errorf("rate = %v, want the minimum of 1", rate)
+	}
+}
+
+func TestRateLimitNil(t *testing.T) {
+	if r := NewRateLimit(0, 0, true); r != nil {
+		t.Fatalf("NewRateLimit(0, 0) = %+v, want nil", r)
+	}
+	var r *RateLimit
+	r.waitRequest()
+	r.waitBytes(100)
+	r.observe(time.Second, http.StatusServiceUnavailable)
+	if state := r.State(); state != "" {
+		t.Errorf("State() = %q", state)
+	}
+}
+
+func TestProgressBarStop(t *testing.T) {
+	l, err := New("http://127.0.0.1", http.DefaultClient, Options{OutputDir: t.TempDir(), RequestsPerSecond: 5, HideProgress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The bar is only refreshed when it is shown
+	l.HideProgress = false
+
+	before := runtime.NumGoroutine()
+	for range 10 {
+		// Bars that are never finished, as on an early return
+		_, stop := l.newProgressBar(10, "test")
+		stop()
+		stop()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines after stopping the bars, %d before", after, before)
+	}
+}
@@ -0,0 +1,276 @@
+package looter
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sccm-http-looter/ntlm"
+)
+
+// ReportFileName is the name of the report saved in the output directory of a DP
+const ReportFileName = "report.json"
+
+// Outcomes of looting a DP
+const (
+	// OutcomeComplete is a DP where every wanted file was downloaded
+	OutcomeComplete = "complete"
+	// OutcomePartial is a DP where some signatures, directory listings, INIs or files could not be downloaded
+	OutcomePartial = "partial"
+	// OutcomeFailed is a DP that could not be looted, i.e. its Datalib could not be listed
+	OutcomeFailed = "failed"
+)
+
+// Report is the summary of looting a DP
+type Report struct {
+	Target string `json:"target"`
+	// Method is how the files were found, "sig" (signatures), "url" (directory listings) or "sig+url" (both), empty if looting stopped before
+	Method  string    `json:"method,omitempty"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Outcome string    `json:"outcome"`
+	// Error is why looting stopped for a failed DP
+	Error    string         `json:"error,omitempty"`
+	Requests RequestSummary `json:"requests"`
+	Files    FileSummary    `json:"files"`
+	// BytesTransferred is the size of all the response bodies read
+	BytesTransferred int64 `json:"bytes_transferred"`
+	// Failures lists every item (Datalib, signature, listing, INI or file) that was still missing at the end
+	Failures []ItemFailure `json:"failures"`
+	// NTLM is what the DP disclosed in its NTLM challenge, if it asked for Windows authentication
+	NTLM *ntlm.ServerInfo `json:"ntlm,omitempty"`
+}
+
+// RequestSummary counts the HTTP requests sent to a DP
+type RequestSummary struct {
+	Total int64 `json:"total"`
+	// ByStatus counts the responses by status code, with "error" for requests that got no response
+	ByStatus map[string]int64 `json:"by_status"`
+	// Transient and Permanent count the requests that failed for good, by class
+	Transient int64 `json:"transient_failures"`
+	Permanent int64 `json:"permanent_failures"`
+}
+
+// FileSummary counts the files of a DP at each stage
+type FileSummary struct {
+	// Enumerated is the number of files found in signatures, directory listings or a plan
+	Enumerated int64 `json:"enumerated"`
+	// Filtered is the number of files skipped by the extension filters
+	Filtered   int64 `json:"filtered"`
+	Downloaded int64 `json:"downloaded"`
+	// Skipped is the number of files already downloaded by the run that is resumed
+	Skipped int64 `json:"skipped"`
+	// Failed is the number of files that neither method could download in the end
+	Failed int64 `json:"failed"`
+	// Verified is the number of downloaded files that matched the hash from their INI
+	Verified int64 `json:"verified"`
+}
+
+// ItemFailure is an item that could not be retrieved
+type ItemFailure struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+	URL  string `json:"url,omitempty"`
+	// Status is "failed" or "corrupt"
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	// Failure is whether a failed request was transient or permanent
+	Failure FailureClass `json:"failure,omitempty"`
+}
+
+// runStats collects what happened while looting a DP, for its Report
+type runStats struct {
+	mu       sync.Mutex
+	start    time.Time
+	method   string
+	statuses map[string]int64
+	bytes    int64
+	files    FileSummary
+	// failures holds the items that failed and were not retrieved since, by reportKey
+	failures map[string]ItemFailure
+	ntlm     *ntlm.ServerInfo
+}
+
+func newRunStats() *runStats {
+	return &runStats{start: time.Now(), statuses: make(map[string]int64), failures: make(map[string]ItemFailure)}
+}
+
+// countResponse counts a response with statusCode, 0 for a request that got no response
+func (s *runStats) countResponse(statusCode int) {
+	status := "error"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	s.mu.Lock()
+	s.statuses[status]++
+	s.mu.Unlock()
+}
+
+func (s *runStats) countBytes(n int) {
+	s.mu.Lock()
+	s.bytes += int64(n)
+	s.mu.Unlock()
+}
+
+// countFiles updates the file counts with update
+func (s *runStats) countFiles(update func(files *FileSummary)) {
+	s.mu.Lock()
+	update(&s.files)
+	s.mu.Unlock()
+}
+
+func (s *runStats) setNTLM(info *ntlm.ServerInfo) {
+	s.mu.Lock()
+	s.ntlm = info
+	s.mu.Unlock()
+}
+
+// failedCount returns the number of items of kind that failed
+func (s *runStats) failedCount(kind string) int {
+	return len(s.failuresOf(kind))
+}
+
+// failuresOf returns the failed items of kind
+func (s *runStats) failuresOf(kind string) []ItemFailure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var failures []ItemFailure
+	for _, failure := range s.failures {
+		if failure.Kind == kind {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// dropFailures removes the failed items for which drop returns true, returning how many were removed
+func (s *runStats) dropFailures(drop func(failure ItemFailure) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.failures)
+	maps.DeleteFunc(s.failures, func(_ string, failure ItemFailure) bool { return drop(failure) })
+	return n - len(s.failures)
+}
+
+func (s *runStats) setMethod(method string) {
+	s.mu.Lock()
+	s.method = method
+	s.mu.Unlock()
+}
+
+// reportKey identifies the item of entry in the report. A file is the same item whether it was found
+// in a signature or a directory listing, and an INI stands for the file it describes.
+func reportKey(entry journalEntry) string {
+	switch {
+	case entry.Kind == kindINI:
+		_, rest, _ := strings.Cut(entry.URL, "/SMS_DP_SMSPKG$/Datalib/")
+		contentID, relativePath, _ := strings.Cut(strings.TrimSuffix(rest, ".INI"), "/")
+		return kindFile + "|" + fileLibKey(contentID, relativePath)
+	case entry.Kind == kindFile && strings.Contains(entry.Key, "/SMS_DP_SMSPKG$/"):
+		return kindFile + "|" + fileLibKey(contentPathFromURL(entry.Key))
+	case entry.Kind == kindFile:
+		// <content ID>/<path> from a signature
+		contentID, relativePath, _ := strings.Cut(entry.Key, "/")
+		return kindFile + "|" + fileLibKey(contentID, relativePath)
+	}
+	return entry.Kind + "|" + entry.Key
+}
+
+// recordResult journals entry as done or as failed with err, and counts it in the report. Only the
+// last result of an item counts, so an item retrieved after failing is not reported as failed.
+func (l *Looter) recordResult(entry journalEntry, err error) {
+	l.state().recordResult(entry, err)
+
+	l.stats.mu.Lock()
+	defer l.stats.mu.Unlock()
+	key := reportKey(entry)
+	switch {
+	case err != nil:
+		failure := ItemFailure{Kind: entry.Kind, Key: entry.Key, URL: entry.URL, Status: statusFailed, Error: err.Error()}
+		if errors.Is(err, errCorrupt) {
+			failure.Status = statusCorrupt
+		}
+		var requestErr *RequestError
+		if errors.As(err, &requestErr) {
+			failure.Failure = requestErr.Class
+		}
+		l.stats.failures[key] = failure
+	// The file of an INI is still to be downloaded
+	case entry.Kind != kindINI:
+		delete(l.stats.failures, key)
+	}
+
+	if entry.Kind == kindFile && err == nil {
+		l.stats.files.Downloaded++
+		if entry.Verified {
+			l.stats.files.Verified++
+		}
+	}
+}
+
+// Report returns the report of this DP so far. lootErr is why looting stopped, nil if it went through.
+func (l *Looter) Report(lootErr error) *Report {
+	transient, permanent := l.Failures()
+	l.stats.mu.Lock()
+	defer l.stats.mu.Unlock()
+
+	report := &Report{
+		Target: l.BaseURL,
+		Method: l.stats.method,
+		Start:  l.stats.start,
+		End:    time.Now(),
+		Requests: RequestSummary{
+			Total:     l.Requests(),
+			ByStatus:  make(map[string]int64, len(l.stats.statuses)),
+			Transient: transient,
+			Permanent: permanent,
+		},
+		Files:            l.stats.files,
+		BytesTransferred: l.stats.bytes,
+		Failures:         []ItemFailure{},
+		NTLM:             l.stats.ntlm,
+	}
+	for status, count := range l.stats.statuses {
+		report.Requests.ByStatus[status] = count
+	}
+	keys := make([]string, 0, len(l.stats.failures))
+	for key := range l.stats.failures {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		failure := l.stats.failures[key]
+		report.Failures = append(report.Failures, failure)
+		// A file whose INI failed is never requested
+		if failure.Kind == kindFile || failure.Kind == kindINI {
+			report.Files.Failed++
+		}
+	}
+
+	switch {
+	case lootErr != nil:
+		report.Outcome = OutcomeFailed
+		report.Error = lootErr.Error()
+	case len(report.Failures) > 0:
+		// Signatures and listings that failed hide files, which are not counted in Files
+		report.Outcome = OutcomePartial
+	default:
+		report.Outcome = OutcomeComplete
+	}
+	return report
+}
+
+// Save writes the report to filePath as JSON
+func (r *Report) Save(filePath string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
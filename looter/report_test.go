@@ -0,0 +1,89 @@
+package looter
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportOutcome(t *testing.T) {
+	dp := &combinedDP{requests: make(map[string]int)}
+	ts := httptest.NewServer(dp)
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		// loot runs the steps of a looting method
+		loot func(l *Looter)
+		want string
+	}{
+		{"complete", func(l *Looter) { l.DownloadCombined([]string{"ABC00001.1"}) }, OutcomeComplete},
+		{"missing signature and listing", func(l *Looter) { l.DownloadCombined([]string{"ABC00001.1", "ABC00002.1"}) }, OutcomePartial},
+		{"missing signature", func(l *Looter) { l.FetchSignatures([]string{"ABC00001.1", "ABC00002.1"}) }, OutcomePartial},
+		{"missing listing", func(l *Looter) { l.ResolveFiles([]string{"ABC00001.1", "ABC00002.1"}) }, OutcomePartial},
+		{"missing INI", func(l *Looter) {
+			l.Download("ABC00001.1.tar", []SignatureEntry{{Path: `Scripts\missing.ps1`}})
+		}, OutcomePartial},
+		// The file of the failed INI is then downloaded from the listing
+		{"missing INI, listed file", func(l *Looter) {
+			l.Download("ABC00001.1.tar", []SignatureEntry{{Path: `sub\a.txt`}})
+			l.DownloadURLs([]string{l.BaseURL + "/SMS_DP_SMSPKG$/ABC00001.1/sub/a.txt"})
+		}, OutcomeComplete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := New(ts.URL, ts.Client(), Options{OutputDir: t.TempDir(), AllowExtensions: []string{"all"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			tt.loot(l)
+			report := l.Report(nil)
+			if report.Outcome != tt.want {
+				t.Errorf("Outcome = %s, want %s (failures %+v)", report.Outcome, tt.want, report.Failures)
+			}
+			if tt.want == OutcomePartial && len(report.Failures) == 0 {
+				t.Errorf("Failures = %+v, want some", report.Failures)
+			}
+			if tt.want == OutcomeComplete && (len(report.Failures) != 0 || report.Files.Failed != 0) {
+				t.Errorf("Failures = %+v and Files = %+v, want none failed", report.Failures, report.Files)
+			}
+		})
+	}
+
+	l, err := New(ts.URL, ts.Client(), Options{OutputDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if report := l.Report(errors.New("HTTP 401")); report.Outcome != OutcomeFailed || report.Error != "HTTP 401" {
+		t.Errorf("Report() = %+v, want failed", report)
+	}
+}
+
+func TestResolveFilesFailedListing(t *testing.T) {
+	dp := &combinedDP{requests: make(map[string]int)}
+	ts := httptest.NewServer(dp)
+	defer ts.Close()
+
+	outputDir := t.TempDir()
+	l, err := New(ts.URL, ts.Client(), Options{OutputDir: outputDir, Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if urls := l.ResolveFiles([]string{"ABC00001.1", "ABC00002.1"}); len(urls) != 2 {
+		t.Errorf("ResolveFiles() = %q, want the 2 files of ABC00001.1", urls)
+	}
+	// A resumed run must list the packages again rather than reuse the incomplete URLs
+	if _, ok := l.state().completed(kindURLs, filepath.Join(outputDir, l.Server+"_urls.txt")); ok {
+		t.Error("the URL list was journaled as complete with a failed listing")
+	}
+	if n := dp.requests["/SMS_DP_SMSPKG$/ABC00002.1"]; n != 1 {
+		t.Errorf("the missing listing was requested %d times, want 1 (404 is permanent)", n)
+	}
+	if report := l.Report(nil); report.Outcome != OutcomePartial || report.Requests.ByStatus["404"] != 1 {
+		t.Errorf("Report() = %+v, want partial with one 404", report)
+	}
+}
@@ -0,0 +1,174 @@
+package looter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// maxRetryAfter caps how long a Retry-After header can make us wait
+const maxRetryAfter = 5 * time.Minute
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a request, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for each following one
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+	// RetryStatuses are the HTTP status codes worth retrying
+	RetryStatuses []int
+}
+
+// DefaultRetryPolicy returns the policy used when Options.Retry is not set
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   3,
+		BaseDelay:     time.Second,
+		MaxDelay:      30 * time.Second,
+		RetryStatuses: []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+// FailureClass is whether a failed request could succeed if it is tried again
+type FailureClass string
+
+const (
+	// FailureTransient is a failure worth retrying, i.e. a timeout, a reset connection or a 503
+	FailureTransient FailureClass = "transient"
+	// FailurePermanent is a failure that will not go away, i.e. a 404 or a 403
+	FailurePermanent FailureClass = "permanent"
+)
+
+// StatusError is the error for a response with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the delay asked by the DP with a Retry-After header, zero if none
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP request failed with status code: %d", e.StatusCode)
+}
+
+// RequestError is a request that failed for good after Attempts attempts
+type RequestError struct {
+	URL      string
+	Class    FailureClass
+	Attempts int
+	Err      error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// errReadBody wraps the error of a response body that could not be read
+var errReadBody = errors.New("error reading response body")
+
+// newStatusError returns the error for response, which has an unexpected status code
+func newStatusError(response *http.Response) *StatusError {
+	return &StatusError{StatusCode: response.StatusCode, RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"))}
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return min(max(time.Until(date), 0), maxRetryAfter)
+	}
+	return 0
+}
+
+// classify returns whether err is worth retrying with policy
+func (p RetryPolicy) classify(err error) FailureClass {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if slices.Contains(p.RetryStatuses, statusErr.StatusCode) {
+			return FailureTransient
+		}
+		return FailurePermanent
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout(),
+		// A body shorter than its Content-Length. A bare io.EOF is the normal end of a read, not a failure.
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE):
+		return FailureTransient
+	}
+	return FailurePermanent
+}
+
+// delay returns how long to wait before attempt (2 for the first retry), after err
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	backoff := p.BaseDelay << (attempt - 2)
+	if p.BaseDelay > 0 && (backoff > p.MaxDelay || backoff <= 0) {
+		// Capped, or overflowed after many attempts
+		backoff = p.MaxDelay
+	}
+	// Jitter so concurrent workers do not retry all at once
+	if backoff > 1 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > backoff {
+		return statusErr.RetryAfter
+	}
+	return backoff
+}
+
+// retry runs request, which fetches url, until it succeeds, fails permanently or runs out of attempts.
+// The final failure is counted by class and returned as a *RequestError.
+func (l *Looter) retry(url string, request func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			delay := l.Retry.delay(attempt, err)
+			slog.Debug(fmt.Sprintf("Retrying %s in %v (attempt %d of %d): %v", url, delay.Round(time.Millisecond), attempt, l.Retry.MaxAttempts, err))
+			time.Sleep(delay)
+		}
+
+		err = request()
+		if err == nil {
+			return nil
+		}
+		class := l.Retry.classify(err)
+		if class == FailurePermanent || attempt >= l.Retry.MaxAttempts {
+			if class == FailureTransient {
+				l.transientFailures.Add(1)
+				slog.Warn(fmt.Sprintf("Giving up on %s after %d attempts: %v", url, attempt, err))
+			} else {
+				l.permanentFailures.Add(1)
+			}
+			return &RequestError{URL: url, Class: class, Attempts: attempt, Err: err}
+		}
+	}
+}
+
+// Failures returns the number of requests that failed for good, by class
+func (l *Looter) Failures() (transient, permanent int64) {
+	return l.transientFailures.Load(), l.permanentFailures.Load()
+}
@@ -0,0 +1,144 @@
+package looter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	tests := []struct {
+		name string
+		err  error
+		want FailureClass
+	}{
+		{"503", &StatusError{StatusCode: http.StatusServiceUnavailable}, FailureTransient},
+		{"429", &StatusError{StatusCode: http.StatusTooManyRequests}, FailureTransient},
+		{"404", &StatusError{StatusCode: http.StatusNotFound}, FailurePermanent},
+		{"401", &StatusError{StatusCode: http.StatusUnauthorized}, FailurePermanent},
+		{"timeout", &url.Error{Op: "Get", URL: "http://dp", Err: timeoutError{}}, FailureTransient},
+		{"short body", fmt.Errorf("%w: %w", errReadBody, io.ErrUnexpectedEOF), FailureTransient},
+		{"connection reset", &url.Error{Op: "Get", URL: "http://dp", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, FailureTransient},
+		{"broken pipe", &net.OpError{Op: "write", Err: syscall.EPIPE}, FailureTransient},
+		{"EOF", io.EOF, FailurePermanent},
+		{"wrapped EOF", &url.Error{Op: "Get", URL: "http://dp", Err: io.EOF}, FailurePermanent},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, FailurePermanent},
+		{"other", errors.New("certificate signed by unknown authority"), FailurePermanent},
+	}
+	for _, tt := range tests {
+		if got := policy.classify(tt.err); got != tt.want {
+			t.Errorf("classify(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	custom := RetryPolicy{RetryStatuses: []int{http.StatusNotFound}}
+	if got := custom.classify(&StatusError{StatusCode: http.StatusNotFound}); got != FailureTransient {
+		t.Errorf("classify(404) = %s with 404 in RetryStatuses, want transient", got)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, want := range map[int]time.Duration{2: time.Second, 3: 2 * time.Second, 5: 8 * time.Second, 6: 10 * time.Second, 100: 10 * time.Second} {
+		// Jitter keeps the delay between half of it and all of it
+		if got := policy.delay(attempt, nil); got < want/2 || got > want {
+			t.Errorf("delay(%d) = %v, want %v to %v", attempt, got, want/2, want)
+		}
+	}
+	if got := policy.delay(2, &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Minute}); got != time.Minute {
+		t.Errorf("delay() = %v with Retry-After: 60, want 1m", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"-1":                            0,
+		"3600":                          maxRetryAfter,
+		"invalid":                       0,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(value); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestListDatalibLastAttempt(t *testing.T) {
+	// A truncated body, then a 503 and finally a 404: the 404 is what failed
+	var attempts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch attempts.Add(1) {
+		case 1:
+			w.Header().Set("Content-Length", "1000")
+			io.WriteString(w, "<html><body><pre>")
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	l, err := New(ts.URL, ts.Client(), Options{OutputDir: t.TempDir(), Retry: RetryPolicy{MaxAttempts: 5, RetryStatuses: DefaultRetryPolicy().RetryStatuses}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	_, err = l.ListDatalib()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || errors.Is(err, errReadBody) {
+		t.Fatalf("ListDatalib() error = %v, want the 404 of the last attempt", err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+	failures := l.Report(nil).Failures
+	if len(failures) != 1 || failures[0].Kind != kindDatalib || failures[0].Failure != FailurePermanent {
+		t.Errorf("Failures = %+v, want a permanent Datalib failure", failures)
+	}
+	if transient, permanent := l.Failures(); transient != 0 || permanent != 1 {
+		t.Errorf("Failures() = %d transient, %d permanent, want 0 and 1", transient, permanent)
+	}
+}
+
+func TestListDatalibTruncated(t *testing.T) {
+	var attempts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Content-Length", "1000")
+		io.WriteString(w, "<html><body><pre>")
+	}))
+	defer ts.Close()
+
+	l, err := New(ts.URL, ts.Client(), Options{OutputDir: t.TempDir(), Retry: RetryPolicy{MaxAttempts: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	_, err = l.ListDatalib()
+	var requestErr *RequestError
+	if !errors.Is(err, errReadBody) || !errors.As(err, &requestErr) || requestErr.Class != FailureTransient || attempts.Load() != 2 {
+		t.Errorf("ListDatalib() error = %v after %d attempts, want a transient read error after 2", err, attempts.Load())
+	}
+}
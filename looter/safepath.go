@@ -0,0 +1,100 @@
+package looter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Names Windows reserves for devices, with or without an extension
+var reservedNames = regexp.MustCompile(`(?i)^(CON|PRN|AUX|NUL|CONIN\$|CONOUT\$|COM[0-9¹²³]|LPT[0-9¹²³])(\..*)?$`)
+
+// Matches a drive letter (C:) or a UNC/device prefix (//server/share/, //?/)
+var absolutePrefix = regexp.MustCompile(`^([a-zA-Z]:|//[^/]*/[^/]*)`)
+
+// maxSegmentLength is the longest file or directory name most file systems allow
+const maxSegmentLength = 255
+
+// sanitizeRelativePath turns an untrusted path from a signature, listing or URL into a relative path
+// that can only name something below the directory it is joined to. Windows separators are normalized,
+// drive letters, absolute and '..' segments are dropped and every segment is made safe for Windows.
+// The result uses / separators and is never empty.
+func sanitizeRelativePath(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = absolutePrefix.ReplaceAllString(name, "")
+
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, sanitizeSegment(segment))
+	}
+	if len(segments) == 0 {
+		return "_"
+	}
+	return strings.Join(segments, "/")
+}
+
+// sanitizeSegment makes a single file or directory name safe to create on any OS
+func sanitizeSegment(segment string) string {
+	var cleaned strings.Builder
+	for _, r := range segment {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			// Drop control characters
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			cleaned.WriteRune('_')
+		default:
+			cleaned.WriteRune(r)
+		}
+	}
+	segment = cleaned.String()
+
+	// Windows silently strips trailing dots and spaces, which can turn "..." into ".."
+	segment = strings.TrimRight(segment, ". ")
+	if segment == "" {
+		return "_"
+	}
+	if reservedNames.MatchString(segment) {
+		segment = "_" + segment
+	}
+	if len(segment) > maxSegmentLength {
+		extension := filepath.Ext(segment)
+		if len(extension) > 16 {
+			extension = ""
+		}
+		segment = strings.ToValidUTF8(segment[:maxSegmentLength-len(extension)], "") + extension
+	}
+	return segment
+}
+
+// safeJoin joins untrusted path elements below root. Each element is sanitized and the result is
+// checked to be inside root, so nothing from a DP can write outside the loot directory.
+func safeJoin(root string, elements ...string) (string, error) {
+	parts := []string{root}
+	for _, element := range elements {
+		parts = append(parts, filepath.FromSlash(sanitizeRelativePath(element)))
+	}
+	joined := filepath.Join(parts...)
+
+	relative, err := filepath.Rel(root, joined)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) || filepath.IsAbs(relative) {
+		return "", fmt.Errorf("path %q escapes %s", strings.Join(elements, "/"), root)
+	}
+	return joined, nil
+}
+
+// isHex reports whether s is a non-empty hex string, as content library hashes are
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
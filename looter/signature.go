@@ -0,0 +1,119 @@
+package looter
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FetchSignatures downloads the SMSSIG .tar signature for every Datalib entry into
+// <OutputDir>/signatures and returns the paths of all signature files on disk
+func (l *Looter) FetchSignatures(filenames []string) []string {
+	l.stats.setMethod(methodSignature)
+
+	// Ensure the output directory exists
+	if err := os.MkdirAll(filepath.Join(l.OutputDir, "signatures"), os.ModePerm); err != nil {
+		slog.Error(fmt.Sprintf("Error creating base output directory: %v\n", err))
+		return nil
+	}
+
+	// Create a wait group to wait for all goroutines to finish
+	var wg sync.WaitGroup
+	wg.Add(len(filenames))
+
+	// Limit the number of concurrent downloads
+	workers := l.newWorkers()
+
+	if l.Randomize {
+		randomizeStrings(filenames)
+	}
+
+	bar, stop := l.newProgressBar(len(filenames), "[cyan][1/2][reset] Getting signature files...")
+	defer stop()
+
+	// Iterate over the filenames and download the files
+	for _, filename := range filenames {
+		bar.Add(1)
+		// Skip INI files as they never have signatures - reduces requests by half!
+		if strings.HasSuffix(filename, ".INI") {
+			wg.Done() // Still need to decrement the wg as we used all file names for the wg size
+			continue
+		}
+
+		// "Take up" one slot/thread
+		workers.acquire()
+
+		go func(filename string) {
+			defer func() {
+				// "Let go" of one slot/thread
+				workers.release()
+				wg.Done()
+			}()
+
+			url := fmt.Sprintf("%s/SMS_DP_SMSSIG$/%s.tar", l.BaseURL, filename)
+			outputPath, err := safeJoin(filepath.Join(l.OutputDir, "signatures"), filename+".tar")
+			if err != nil {
+				slog.Debug(fmt.Sprintf("Skipping signature %s: %v", filename, err))
+				return
+			}
+
+			if _, ok := l.state().completed(kindSignature, url); ok {
+				return
+			}
+
+			// Download the file
+			err = l.downloadFileFromURL(url, outputPath)
+			l.recordResult(journalEntry{Kind: kindSignature, Key: url, URL: url, Path: outputPath}, err)
+			if err != nil {
+				slog.Debug(fmt.Sprintf("Error downloading signature %s.tar: %v\n", filename, err))
+				return
+			}
+
+			slog.Debug(fmt.Sprintf("Downloaded %s to %s\n", filename, outputPath))
+		}(filename)
+	}
+	wg.Wait()
+	bar.Finish()
+
+	return SignatureFiles(filepath.Join(l.OutputDir, "signatures"))
+}
+
+// SignatureFiles returns the paths of all signature files in signaturesDir
+func SignatureFiles(signaturesDir string) []string {
+	return walkDir(signaturesDir)
+}
+
+// DownloadFromSignatures gets the file names from every signature, then downloads the INI and finally the file
+func (l *Looter) DownloadFromSignatures(signaturePaths []string) {
+	l.stats.setMethod(methodSignature)
+	if l.Randomize {
+		randomizeStrings(signaturePaths)
+	}
+
+	bar, stop := l.newProgressBar(len(signaturePaths), "[cyan][2/2][reset] Getting files...")
+	defer stop()
+
+	var fileNames []string
+	for _, signaturePath := range signaturePaths {
+		bar.Add(1)
+
+		entries, err := ParseSignatureFile(signaturePath)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error parsing signature %s: %v", signaturePath, err))
+			continue
+		}
+		for _, entry := range entries {
+			fileNames = append(fileNames, entry.Path)
+		}
+		// Download all the wanted files
+		l.Download(signaturePath, entries)
+	}
+	bar.Finish()
+	// Save filenames to disk, replacing those of a previous run
+	if err := writeStringArrayToFile(filepath.Join(l.OutputDir, l.Server+"_files.txt"), fileNames); err != nil {
+		slog.Error(fmt.Sprintf("Error saving file names: %v", err))
+	}
+}
@@ -0,0 +1,273 @@
+package looter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rdcHeaderSize is the size of the header at the start of the RDC signature of every file
+const rdcHeaderSize = 24
+
+// rdcMagic is the start of the RDC header of signatures with the known format version
+var rdcMagic = []byte{0x18, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01}
+
+// rdcBlockSize is the size of a block of an RDC signature (RdcSignature): the 16-byte hash of a chunk
+// of the file followed by its length as a little-endian uint16
+const rdcBlockSize = 18
+
+// blockSize is the size of the records of a signature and of the tar archives they mimic
+const blockSize = 512
+
+// Fields of a record header, which is laid out like a tar header
+const (
+	headerName     = 0
+	headerMode     = 100
+	headerSize     = 124
+	headerModTime  = 136
+	headerTypeflag = 156
+	headerMagic    = 257
+	headerPrefix   = 345
+)
+
+// Typeflags of the records of a signature
+const (
+	typeFile     = '0'
+	typeOldFile  = 0
+	typeLongName = 'L'
+)
+
+// SignatureEntry is a file listed in a SMSSIG .tar signature. The signature holds the RDC
+// signature of each file of a package, named after the file's path in the package.
+type SignatureEntry struct {
+	// Path is the relative path of the file in the package, using / separators
+	Path string
+	// Size is the size of the file, the sum of the chunk lengths of its RDC signature, -1 when the
+	// signature has several recursion levels or an unknown format
+	Size int64
+	// SignatureSize is the size of the RDC signature of the file
+	SignatureSize int64
+	// ModTime is the modification time from the record header, often zero
+	ModTime time.Time
+	// Mode is the mode from the record header, often zero
+	Mode int64
+	// DataOffset is the offset of the RDC signature in the .tar file
+	DataOffset int64
+	// RDC is the header of the RDC signature, nil if the signature has none
+	RDC *RDCHeader
+}
+
+// RDCHeader is the fixed-size header at the start of an RDC signature
+type RDCHeader struct {
+	HeaderSize uint32
+	// Versions are the format version numbers, all 1 in known signatures
+	Versions [4]uint16
+	Reserved uint32
+	// RecursionDepth is the number of RDC recursion levels in the signature
+	RecursionDepth uint32
+	Reserved2      uint32
+}
+
+// ParseSignatureFile returns the files listed in a SMSSIG .tar signature file
+func ParseSignatureFile(filePath string) ([]SignatureEntry, error) {
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSignature(fileData)
+}
+
+// ParseSignature returns the files listed in SMSSIG .tar signature data.
+//
+// A signature is a sequence of records laid out like tar entries: a 512-byte header with the
+// name, octal size, typeflag and "ustar" magic of the entry, then the RDC signature of the file
+// padded to 512 bytes. The SCCM content library leaves the mode, owner, time and checksum fields
+// empty, which is why archive/tar rejects signatures. Records that cannot be decoded are skipped up
+// to the next valid header.
+func ParseSignature(data []byte) ([]SignatureEntry, error) {
+	entries := []SignatureEntry{}
+	var longName string
+	for offset := 0; offset+blockSize <= len(data); {
+		header := data[offset : offset+blockSize]
+		if isZero(header) {
+			// The end of the archive
+			break
+		}
+		record, ok := parseRecordHeader(header)
+		if !ok {
+			next := nextRecordHeader(data, offset+1)
+			slog.Debug(fmt.Sprintf("Invalid signature record at offset %d, skipping %d bytes", offset, next-offset))
+			offset, longName = next, ""
+			continue
+		}
+
+		dataOffset := offset + blockSize
+		// A record past the end is a truncated signature
+		dataEnd := len(data)
+		offset = len(data)
+		if record.size <= int64(len(data)-dataOffset) {
+			dataEnd = dataOffset + int(record.size)
+			offset = min(dataOffset+(int(record.size)+blockSize-1)/blockSize*blockSize, len(data))
+		}
+
+		switch record.typeflag {
+		case typeLongName:
+			// GNU long name record, naming the next entry
+			longName = cString(data[dataOffset:dataEnd])
+			continue
+		case typeFile, typeOldFile:
+		default:
+			longName = ""
+			continue
+		}
+
+		entry := SignatureEntry{
+			Path:          record.name,
+			Size:          -1,
+			SignatureSize: record.size,
+			ModTime:       record.modTime,
+			Mode:          record.mode,
+			DataOffset:    int64(dataOffset),
+		}
+		if longName != "" {
+			entry.Path, longName = longName, ""
+		}
+		entry.Path = strings.ReplaceAll(entry.Path, "\\", "/")
+		signature := data[dataOffset:dataEnd]
+		if entry.RDC = parseRDCHeader(signature); entry.RDC != nil && dataEnd-dataOffset == int(record.size) {
+			entry.Size = rdcFileSize(entry.RDC, signature[rdcHeaderSize:])
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 && len(data) > 0 {
+		return nil, errors.New("no files in signature")
+	}
+	return entries, nil
+}
+
+// recordHeader is the decoded header of a signature record
+type recordHeader struct {
+	name     string
+	typeflag byte
+	size     int64
+	mode     int64
+	modTime  time.Time
+}
+
+// parseRecordHeader decodes a 512-byte record header, returning false if it is not a valid one
+func parseRecordHeader(header []byte) (recordHeader, bool) {
+	var record recordHeader
+	if !bytes.HasPrefix(header[headerMagic:], []byte("ustar")) {
+		return record, false
+	}
+	record.name = cString(header[headerName:headerMode])
+	if prefix := cString(header[headerPrefix : headerPrefix+155]); prefix != "" && string(header[headerMagic:headerMagic+6]) == "ustar\x00" {
+		// POSIX ustar splits long names
+		record.name = prefix + "/" + record.name
+	}
+	record.typeflag = header[headerTypeflag]
+
+	var ok bool
+	if record.size, ok = parseNumeric(header[headerSize:headerModTime]); !ok || record.size < 0 {
+		return record, false
+	}
+	if record.name == "" && record.typeflag != typeLongName {
+		return record, false
+	}
+	// The mode and time are informative, and empty in most signatures
+	record.mode, _ = parseNumeric(header[headerMode : headerMode+8])
+	if modTime, _ := parseNumeric(header[headerModTime : headerModTime+12]); modTime > 0 {
+		record.modTime = time.Unix(modTime, 0).UTC()
+	}
+	return record, true
+}
+
+// nextRecordHeader returns the offset of the first valid record header at or after from, or the
+// length of data if there is none
+func nextRecordHeader(data []byte, from int) int {
+	for {
+		i := bytes.Index(data[min(from+headerMagic, len(data)):], []byte("ustar"))
+		if i < 0 {
+			return len(data)
+		}
+		start := from + i
+		if start+blockSize > len(data) {
+			return len(data)
+		}
+		if _, ok := parseRecordHeader(data[start : start+blockSize]); ok {
+			return start
+		}
+		from = start + 1
+	}
+}
+
+// parseNumeric decodes a numeric header field, octal text or GNU base-256 for large values. An
+// empty field is 0.
+func parseNumeric(field []byte) (int64, bool) {
+	if len(field) > 0 && field[0]&0x80 != 0 {
+		// Base-256, big-endian with the high bit of the first byte as a marker
+		if len(field) > 9 {
+			return 0, false
+		}
+		n := int64(field[0] & 0x7f)
+		for _, b := range field[1:] {
+			n = n<<8 | int64(b)
+		}
+		return n, true
+	}
+	text := strings.Trim(string(field), " \x00")
+	if text == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(text, 8, 64)
+	return n, err == nil
+}
+
+// cString returns the text of b up to its first NUL byte
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRDCHeader decodes an RDC header, returning nil if data does not start with one
+func parseRDCHeader(data []byte) *RDCHeader {
+	if len(data) < rdcHeaderSize || !bytes.Equal(data[:len(rdcMagic)], rdcMagic) {
+		return nil
+	}
+	var header RDCHeader
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
+		return nil
+	}
+	return &header
+}
+
+// rdcFileSize returns the size of the file of an RDC signature with the blocks in signature, or -1
+// if it cannot be computed. With several recursion levels the blocks are the chunks of the
+// signature of the level below, not of the file.
+func rdcFileSize(header *RDCHeader, blocks []byte) int64 {
+	if header.RecursionDepth != 1 || len(blocks)%rdcBlockSize != 0 {
+		return -1
+	}
+	var size int64
+	for i := 0; i < len(blocks); i += rdcBlockSize {
+		size += int64(binary.LittleEndian.Uint16(blocks[i+rdcBlockSize-2:]))
+	}
+	return size
+}
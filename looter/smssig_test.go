@@ -0,0 +1,201 @@
+package looter
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signatureRecord returns a signature record as the SCCM content library writes it: a GNU tar
+// header with only the name, size, typeflag and magic set, then data padded to 512 bytes
+func signatureRecord(name string, typeflag byte, data []byte) []byte {
+	header := make([]byte, blockSize)
+	copy(header[headerName:], name)
+	copy(header[headerSize:], fmt.Sprintf("%o", len(data)))
+	header[headerTypeflag] = typeflag
+	copy(header[headerMagic:], "ustar  \x00")
+	record := append(header, data...)
+	return append(record, make([]byte, (blockSize-len(data)%blockSize)%blockSize)...)
+}
+
+// rdcSignature returns an RDC signature with depth recursion levels and a block for each chunk length
+func rdcSignature(depth uint32, lengths ...uint16) []byte {
+	signature := bytes.Clone(rdcMagic)
+	signature = append(signature, 0, 0, 0, 0, 0)
+	signature = binary.LittleEndian.AppendUint32(signature, depth)
+	signature = append(signature, 0, 0, 0, 0)
+	for i, length := range lengths {
+		signature = append(signature, bytes.Repeat([]byte{byte(i + 1)}, 16)...)
+		signature = binary.LittleEndian.AppendUint16(signature, length)
+	}
+	return signature
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestParseSignatureCapture(t *testing.T) {
+	// The signature of a package with ccmsetup.cab shown in imgs/signature-hex.png
+	entries, err := ParseSignatureFile(filepath.Join("testdata", "ccmsetup.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("ParseSignatureFile() = %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Path != "ccmsetup.cab" || entry.SignatureSize != 150 || entry.DataOffset != 512 || !entry.ModTime.IsZero() {
+		t.Errorf("entry = %+v", entry)
+	}
+	// 7 chunks of 2068, 1691, 2000, 1246, 2166, 1134 and 2032 bytes
+	if entry.Size != 12337 {
+		t.Errorf("Size = %d, want 12337", entry.Size)
+	}
+	if entry.RDC == nil || entry.RDC.RecursionDepth != 1 || entry.RDC.Versions != [4]uint16{1, 1, 1, 1} {
+		t.Errorf("RDC = %+v", entry.RDC)
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	setup := signatureRecord(`Scripts\Install\setup.ps1`, typeFile, rdcSignature(1, 4000, 1200))
+	unattend := signatureRecord("unattend.xml", typeFile, rdcSignature(1, 900))
+	longPath := `Drivers\Dell\Latitude 7490\Windows 10 x64\Network\Intel(R) Ethernet Connection I219-LM\PRO1000\Winx64\NDIS65\e1d65x64.inf`
+
+	tests := []struct {
+		name string
+		data []byte
+		want []SignatureEntry
+	}{
+		{
+			name: "package",
+			data: concat(setup, unattend),
+			want: []SignatureEntry{
+				{Path: "Scripts/Install/setup.ps1", Size: 5200, SignatureSize: 60, DataOffset: 512},
+				{Path: "unattend.xml", Size: 900, SignatureSize: 42, DataOffset: 1536},
+			},
+		},
+		{
+			name: "end of archive",
+			data: concat(unattend, make([]byte, 2*blockSize), []byte("trailing data")),
+			want: []SignatureEntry{{Path: "unattend.xml", Size: 900, SignatureSize: 42, DataOffset: 512}},
+		},
+		{
+			name: "long name",
+			data: concat(signatureRecord("././@LongLink", typeLongName, append([]byte(longPath), 0)), signatureRecord(longPath[:100], typeFile, rdcSignature(1, 100))),
+			want: []SignatureEntry{{Path: "Drivers/Dell/Latitude 7490/Windows 10 x64/Network/Intel(R) Ethernet Connection I219-LM/PRO1000/Winx64/NDIS65/e1d65x64.inf", Size: 100, SignatureSize: 42, DataOffset: 1536}},
+		},
+		{
+			name: "several recursion levels",
+			data: signatureRecord("install.wim", typeFile, rdcSignature(2, 60000, 60000)),
+			want: []SignatureEntry{{Path: "install.wim", Size: -1, SignatureSize: 60, DataOffset: 512}},
+		},
+		{
+			name: "no RDC header",
+			data: signatureRecord("empty.txt", typeFile, nil),
+			want: []SignatureEntry{{Path: "empty.txt", Size: -1, DataOffset: 512}},
+		},
+		{
+			name: "shifted record",
+			// Bytes inserted between records, which moves the next header off the 512-byte grid
+			data: concat(setup, []byte("garbage"), unattend),
+			want: []SignatureEntry{
+				{Path: "Scripts/Install/setup.ps1", Size: 5200, SignatureSize: 60, DataOffset: 512},
+				{Path: "unattend.xml", Size: 900, SignatureSize: 42, DataOffset: 1024 + 7 + 512},
+			},
+		},
+		{
+			name: "directories skipped",
+			data: concat(signatureRecord(`Scripts\`, '5', nil), unattend),
+			want: []SignatureEntry{{Path: "unattend.xml", Size: 900, SignatureSize: 42, DataOffset: 1024}},
+		},
+		{
+			name: "truncated",
+			data: concat(unattend, setup[:blockSize+30]),
+			want: []SignatureEntry{
+				{Path: "unattend.xml", Size: 900, SignatureSize: 42, DataOffset: 512},
+				{Path: "Scripts/Install/setup.ps1", Size: -1, SignatureSize: 60, DataOffset: 1536},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseSignature(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("ParseSignature() = %+v, want %+v", entries, tt.want)
+			}
+			for i, entry := range entries {
+				want := tt.want[i]
+				if entry.Path != want.Path || entry.Size != want.Size || entry.SignatureSize != want.SignatureSize || entry.DataOffset != want.DataOffset {
+					t.Errorf("entry %d = %+v, want %+v", i, entry, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSignatureTar(t *testing.T) {
+	// A real tar, with the mode, time and checksum set
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	signature := rdcSignature(1, 300, 200)
+	if err := writer.WriteHeader(&tar.Header{Name: "deploy/run.cmd", Mode: 0o644, Size: int64(len(signature)), ModTime: modTime, Format: tar.FormatUSTAR}); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(signature)
+	writer.Close()
+
+	entries, err := ParseSignature(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "deploy/run.cmd" || entries[0].Size != 500 || entries[0].Mode != 0o644 || !entries[0].ModTime.Equal(modTime) {
+		t.Errorf("ParseSignature() = %+v", entries)
+	}
+}
+
+func TestParseSignatureInvalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"html":     []byte("<html><body>The resource cannot be found.</body></html>"),
+		"zeros":    make([]byte, 4*blockSize),
+		"bad size": func() []byte { r := signatureRecord("a.txt", typeFile, nil); copy(r[headerSize:], "9z"); return r }(),
+	} {
+		if entries, err := ParseSignature(data); err == nil {
+			t.Errorf("ParseSignature(%s) = %+v, want an error", name, entries)
+		}
+	}
+}
+
+func FuzzParseSignature(f *testing.F) {
+	corpus, _ := filepath.Glob(filepath.Join("testdata", "*.tar"))
+	for _, path := range corpus {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add(concat(signatureRecord(`a\b.txt`, typeFile, rdcSignature(1, 10)), []byte("x"), signatureRecord("c.xml", typeFile, rdcSignature(2, 1))))
+	f.Add(signatureRecord("././@LongLink", typeLongName, []byte("long")))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		entries, err := ParseSignature(data)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if entry.DataOffset < blockSize || entry.DataOffset > int64(len(data)) || entry.SignatureSize < 0 || entry.Size < -1 {
+				t.Errorf("invalid entry %+v for %d bytes", entry, len(data))
+			}
+		}
+	})
+}
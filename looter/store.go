@@ -0,0 +1,229 @@
+package looter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Link modes used to place store blobs in the files/<ext>/ layout
+const (
+	LinkHard    = "hard"
+	LinkSymlink = "symlink"
+	LinkCopy    = "copy"
+	LinkNone    = "none"
+)
+
+// storeManifestFileName maps every (DP, content ID, path) seen to the blob holding its content
+const storeManifestFileName = "manifest.jsonl"
+
+// StoreReference records that a file in a package on a DP has the content of a blob
+type StoreReference struct {
+	Hash      string `json:"hash"`
+	Blob      string `json:"blob"`
+	DP        string `json:"dp"`
+	ContentID string `json:"content_id"`
+	Path      string `json:"path"`
+}
+
+// ContentStore saves every unique file once, keyed by its full hash, no matter how many
+// packages or DPs it is found in. It is safe for concurrent use and may be shared by Looters.
+type ContentStore struct {
+	dir string
+
+	mu         sync.Mutex
+	inflight   map[string]*storeFetch
+	references map[StoreReference]bool
+	manifest   *jsonlFile
+}
+
+// storeFetch lets concurrent requests for the same blob wait for a single download
+type storeFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// OpenStore opens (or creates) the content store in dir
+func OpenStore(dir string) (*ContentStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &ContentStore{
+		dir:        dir,
+		inflight:   make(map[string]*storeFetch),
+		references: make(map[StoreReference]bool),
+	}
+
+	manifestPath := filepath.Join(dir, storeManifestFileName)
+	if file, err := os.Open(manifestPath); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var ref StoreReference
+			if err := json.Unmarshal(scanner.Bytes(), &ref); err == nil {
+				s.references[ref] = true
+			}
+		}
+		file.Close()
+	}
+
+	manifest, err := openJSONL(manifestPath, false)
+	if err != nil {
+		return nil, err
+	}
+	s.manifest = manifest
+	return s, nil
+}
+
+// Close closes the store manifest
+func (s *ContentStore) Close() error {
+	return s.manifest.close()
+}
+
+// BlobPath returns where the blob with hash is kept, mirroring the FileLib layout
+func (s *ContentStore) BlobPath(hash string) string {
+	hash = strings.ToUpper(hash)
+	return filepath.Join(s.dir, hash[0:4], hash)
+}
+
+// fetch returns the path of the blob for hash, calling download to fill it if it is not in
+// the store yet. download is called at most once at a time per hash, other callers wait for it.
+func (s *ContentStore) fetch(hash string, download func(outputPath string) error) (string, error) {
+	if len(hash) < 4 || !isHex(hash) {
+		return "", fmt.Errorf("invalid hash: %q", hash)
+	}
+	blobPath := s.BlobPath(hash)
+
+	s.mu.Lock()
+	if _, err := os.Stat(blobPath); err == nil {
+		s.mu.Unlock()
+		return blobPath, nil
+	}
+	if fetch, ok := s.inflight[blobPath]; ok {
+		s.mu.Unlock()
+		<-fetch.done
+		return blobPath, fetch.err
+	}
+	fetch := &storeFetch{done: make(chan struct{})}
+	s.inflight[blobPath] = fetch
+	s.mu.Unlock()
+
+	fetch.err = s.fill(blobPath, download)
+
+	s.mu.Lock()
+	delete(s.inflight, blobPath)
+	s.mu.Unlock()
+	close(fetch.done)
+	return blobPath, fetch.err
+}
+
+// fill downloads to a temporary file and moves it into place, so a blob is either complete or missing
+func (s *ContentStore) fill(blobPath string, download func(outputPath string) error) error {
+	if err := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); err != nil {
+		return err
+	}
+	tmpPath := blobPath + ".part"
+	if err := download(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, blobPath)
+}
+
+// addReference records ref in the manifest unless it was already recorded
+func (s *ContentStore) addReference(ref StoreReference) {
+	ref.Hash = strings.ToUpper(ref.Hash)
+	if blob, err := filepath.Rel(s.dir, s.BlobPath(ref.Hash)); err == nil {
+		ref.Blob = filepath.ToSlash(blob)
+	}
+
+	s.mu.Lock()
+	if s.references[ref] {
+		s.mu.Unlock()
+		return
+	}
+	s.references[ref] = true
+	s.mu.Unlock()
+	if err := s.manifest.write(ref); err != nil {
+		slog.Error(fmt.Sprintf("Error writing to store manifest: %v", err))
+	}
+}
+
+// materialize places the blob at outputPath using the link mode, falling back to a copy
+// when the file system does not support links
+func materialize(blobPath, outputPath, mode string) error {
+	if mode == LinkNone {
+		return nil
+	}
+	if _, err := os.Lstat(outputPath); err == nil {
+		if err := os.Remove(outputPath); err != nil {
+			return err
+		}
+	}
+
+	switch mode {
+	case LinkSymlink:
+		target, err := filepath.Rel(filepath.Dir(outputPath), blobPath)
+		if err != nil {
+			target = blobPath
+		}
+		if err := os.Symlink(target, outputPath); err == nil {
+			return nil
+		}
+	case LinkHard, "":
+		if err := os.Link(blobPath, outputPath); err == nil {
+			return nil
+		}
+	}
+	return copyFile(blobPath, outputPath)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// storeFile gets the blob for hash into the content store, downloading it with download only if it
+// is not there yet, and places it at outputPath. It returns the local path of the file.
+func (l *Looter) storeFile(hash, contentID, path, outputPath string, download func(outputPath string) error) (string, error) {
+	blobPath, err := l.Store.fetch(hash, download)
+	if err != nil {
+		return "", err
+	}
+	l.Store.addReference(StoreReference{Hash: hash, DP: l.BaseURL, ContentID: contentID, Path: path})
+	if l.Link == LinkNone {
+		return blobPath, nil
+	}
+	return outputPath, materialize(blobPath, outputPath, l.Link)
+}
+
+// contentPathFromURL splits a URL below SMS_DP_SMSPKG$ into the content ID and the path of the file in it
+func contentPathFromURL(fileURL string) (string, string) {
+	_, rest, found := strings.Cut(fileURL, "/SMS_DP_SMSPKG$/")
+	if !found {
+		return "", extractFileName(fileURL)
+	}
+	contentID, path, _ := strings.Cut(rest, "/")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	return contentID, path
+}
@@ -0,0 +1,93 @@
+package looter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ParseTargets reads one DP per line from r and returns their base URLs. Lines may be a
+// URL (https://dp.corp.local:8443) or a host[:port], in which case defaultProtocol and
+// defaultPort fill in the blanks. Blank lines and anything after a '#' are ignored.
+func ParseTargets(r io.Reader, defaultProtocol, defaultPort string) ([]string, error) {
+	var targets []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		target, err := normalizeTarget(line, defaultProtocol, defaultPort)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// normalizeTarget turns a target line into a base URL of the form protocol://host:port
+func normalizeTarget(target, defaultProtocol, defaultPort string) (string, error) {
+	if !strings.Contains(target, "://") {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			// No port given
+			host, port = strings.Trim(target, "[]"), defaultPort
+		}
+		if host == "" {
+			return "", fmt.Errorf("invalid target: %s", target)
+		}
+		return fmt.Sprintf("%s://%s", defaultProtocol, net.JoinHostPort(host, port)), nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported protocol %q in target: %s", u.Scheme, target)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid target: %s", target)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return fmt.Sprintf("%s://%s", u.Scheme, net.JoinHostPort(u.Hostname(), port)), nil
+}
+
+// TargetDirName returns a file system safe directory name for the DP at baseURL, i.e.
+// https_dp01.corp.local_443. The scheme is part of it as HTTP and HTTPS can be served on the same port.
+func TargetDirName(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return strings.NewReplacer(":", "_", "/", "_").Replace(baseURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return u.Scheme + "_" + strings.ReplaceAll(u.Hostname(), ":", "_") + "_" + port
+}
@@ -0,0 +1,20 @@
+package looter
+
+import "testing"
+
+func TestTargetDirName(t *testing.T) {
+	for _, tt := range []struct {
+		baseURL, want string
+	}{
+		{"http://dp01.corp.local", "http_dp01.corp.local_80"},
+		{"https://dp01.corp.local", "https_dp01.corp.local_443"},
+		// The same port with both schemes
+		{"http://dp01:8080", "http_dp01_8080"},
+		{"https://dp01:8080", "https_dp01_8080"},
+		{"http://[fe80::1]:80", "http_fe80__1_80"},
+	} {
+		if got := TargetDirName(tt.baseURL); got != tt.want {
+			t.Errorf("TargetDirName(%s) = %s, want %s", tt.baseURL, got, tt.want)
+		}
+	}
+}
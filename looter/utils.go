@@ -0,0 +1,302 @@
+package looter
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// maxListingDepth caps how deep the directories of a package are listed, against listings that
+// link to ever deeper directories
+const maxListingDepth = 32
+
+// Download fetches the INI and then the file itself for every wanted file
+// parsed from the signature at signaturePath
+func (l *Looter) Download(signaturePath string, entries []SignatureEntry) {
+	contentID := signatureContentID(signaturePath)
+	var fileNames []string
+	for _, entry := range entries {
+		l.signatureFiles.Store(fileLibKey(contentID, entry.Path), true)
+		if l.fileWanted(entry.Path) {
+			fileNames = append(fileNames, entry.Path)
+		} else {
+			l.recordFiltered(ManifestRecord{ContentID: contentID, OriginalPath: entry.Path, Method: methodSignature})
+		}
+	}
+	l.countEnumerated(len(entries), len(entries)-len(fileNames))
+	l.downloadPackage(contentID, fileNames)
+}
+
+// signatureContentID returns the content ID of the package of the signature at signaturePath
+func signatureContentID(signaturePath string) string {
+	filenameWithExt := filepath.Base(signaturePath)
+	return strings.TrimSuffix(filenameWithExt, filepath.Ext(filenameWithExt))
+}
+
+// downloadPackage fetches the INI and then the file itself for every file name of package dirName
+func (l *Looter) downloadPackage(dirName string, fileNames []string) {
+	outPath := filepath.Join(l.OutputDir, "inis")
+
+	// Create a wait group to wait for all goroutines to finish
+	var wg sync.WaitGroup
+	wg.Add(len(fileNames))
+
+	// Limit the number of concurrent downloads
+	workers := l.newWorkers()
+
+	if l.Randomize {
+		randomizeStrings(fileNames)
+	}
+
+	// Iterate over the filenames and download the files
+	for _, filename := range fileNames {
+		// "Take up" one slot/thread
+		workers.acquire()
+		go l.downloadINIAndFile(outPath, filename, dirName, &wg, workers)
+	}
+	wg.Wait()
+
+}
+
+func extractFileName(href string) string {
+	// Split the URL by '/'
+	parts := strings.Split(href, "/")
+	// Get the last part of the URL
+	lastPart := parts[len(parts)-1]
+	// Remove any leading or trailing spaces
+	trimmedPart := strings.TrimSpace(lastPart)
+	return trimmedPart
+}
+
+func randomizeStrings(strings []string) {
+	// Create a new source for random numbers
+	source := rand.NewSource(time.Now().UnixNano())
+	random := rand.New(source)
+
+	// Randomize the order of the slice using sort.Slice
+	sort.Slice(strings, func(i, j int) bool {
+		return random.Intn(2) == 0
+	})
+}
+
+// listDirectory returns the file and directory URLs of the IIS directory listing at fileDirectoryURL
+func (l *Looter) listDirectory(fileDirectoryURL string) ([]string, []string) {
+	html, err := l.getURL(fileDirectoryURL)
+	l.recordResult(journalEntry{Kind: kindListing, Key: fileDirectoryURL, URL: fileDirectoryURL}, err)
+	if err != nil {
+		return nil, nil
+	}
+
+	var fileURLs []string
+	var dirURLs []string
+	for _, entry := range ParseListing(html, fileDirectoryURL) {
+		if entry.IsDir {
+			dirURLs = append(dirURLs, entry.URL)
+			continue
+		}
+		fileURLs = append(fileURLs, entry.URL)
+		if entry.Size >= 0 {
+			l.listedSizes.Store(entry.URL, entry.Size)
+		}
+	}
+
+	return fileURLs, dirURLs
+}
+
+// ResolveFiles walks the directory listing of every Datalib directory and returns the URLs of all files found
+func (l *Looter) ResolveFiles(dataLibFiles []string) []string {
+	l.stats.setMethod(methodURL)
+	urlsPath := filepath.Join(l.OutputDir, l.Server+"_urls.txt")
+
+	// Reuse the URLs found by the previous run
+	if _, ok := l.state().completed(kindURLs, urlsPath); ok {
+		urls, err := ReadLines(urlsPath)
+		if err == nil {
+			slog.Info(fmt.Sprintf("Using file URLs saved in %s", urlsPath))
+			return urls
+		}
+	}
+
+	bar, stop := l.newProgressBar(-1, "[cyan][1/2][reset] Getting file URLs")
+	defer stop()
+	failedListings := l.stats.failedCount(kindListing)
+
+	// Create a wait group to wait for all goroutines to finish
+	var wg sync.WaitGroup
+	wg.Add(len(dataLibFiles))
+	// Create a mutex for file appending
+	mu := &sync.Mutex{}
+	var allFileURLs []string
+	// Directories already listed, so a listing that links back to a directory is only walked once
+	visited := make(map[string]bool)
+
+	// Limit the number of concurrent downloads
+	workers := l.newWorkers()
+
+	if l.Randomize {
+		randomizeStrings(dataLibFiles)
+	}
+
+	for _, dataLibFile := range dataLibFiles {
+		// Skip INI files
+		if strings.HasSuffix(dataLibFile, ".INI") {
+			wg.Done()
+			continue
+		}
+		var fileDirectoryURL string
+		if !strings.Contains(dataLibFile, "http") {
+			fileDirectoryURL = fmt.Sprintf("%s/SMS_DP_SMSPKG$/%s", l.BaseURL, dataLibFile)
+		} else {
+			fileDirectoryURL = dataLibFile
+		}
+
+		// "Take up" one slot/thread
+		workers.acquire()
+		go l.getFilesFromDirNames(fileDirectoryURL, 0, visited, &allFileURLs, bar, &wg, workers, mu)
+
+	}
+	wg.Wait()
+	bar.Finish()
+	// Save URLs to disk, replacing those of a previous run
+	if err := writeStringArrayToFile(urlsPath, allFileURLs); err != nil {
+		slog.Error(fmt.Sprintf("Error saving file URLs: %v", err))
+	}
+	// The URLs are only reused by a resumed run if no listing is missing
+	if failed := l.stats.failedCount(kindListing) - failedListings; failed > 0 {
+		slog.Warn(fmt.Sprintf("%d directory listings of %s failed, files in them are missing", failed, l.BaseURL))
+	} else {
+		l.recordResult(journalEntry{Kind: kindURLs, Key: urlsPath, Path: urlsPath}, nil)
+	}
+	return allFileURLs
+
+}
+
+// DownloadURLs downloads every wanted file URL, naming each file after the hash of its content
+func (l *Looter) DownloadURLs(fileURLs []string) {
+	l.stats.setMethod(methodURL)
+	wanted, filtered := l.wantedURLs(fileURLs)
+	for _, fileURL := range filtered {
+		contentID, relativePath := contentPathFromURL(fileURL)
+		record := ManifestRecord{ContentID: contentID, OriginalPath: relativePath, URL: fileURL, Method: methodURL}
+		if size, ok := l.listedSizes.Load(fileURL); ok {
+			record.Size = size.(int64)
+		}
+		l.recordFiltered(record)
+	}
+	l.downloadURLs(wanted)
+}
+
+// wantedURLs splits the file URLs into those that pass the extension filters and those that do not.
+// Files also found in a signature were already counted.
+func (l *Looter) wantedURLs(fileURLs []string) (wanted, filtered []string) {
+	enumerated := 0
+	for _, fileURL := range fileURLs {
+		if fileURL == "" {
+			continue
+		}
+		if _, ok := l.signatureFiles.Load(fileLibKey(contentPathFromURL(fileURL))); !ok {
+			enumerated++
+		}
+		if l.fileWanted(extractFileName(fileURL)) {
+			wanted = append(wanted, fileURL)
+		} else {
+			filtered = append(filtered, fileURL)
+		}
+	}
+	l.countEnumerated(enumerated, len(filtered))
+	return wanted, filtered
+}
+
+func (l *Looter) downloadURLs(fileURLs []string) {
+	bar, stop := l.newProgressBar(len(fileURLs), "[cyan][2/2][reset] Getting files...")
+	defer stop()
+	var wg sync.WaitGroup
+
+	// Limit the number of concurrent downloads
+	workers := l.newWorkers()
+
+	for _, fileURL := range fileURLs {
+		bar.Add(1)
+		wg.Add(1)
+		// "Take up" one slot/thread
+		workers.acquire()
+		go l.downloadFileFromURLAsHashName(fileURL, &wg, workers)
+	}
+	wg.Wait()
+	bar.Finish()
+}
+
+// getFilesFromDirNames lists the directory at fileDirectoryURL, depth levels below its package, and
+// then its subdirectories that are not in visited
+func (l *Looter) getFilesFromDirNames(fileDirectoryURL string, depth int, visited map[string]bool, allFileURLs *[]string, bar *progressbar.ProgressBar, wg *sync.WaitGroup, workers *workers, mu *sync.Mutex) {
+	mu.Lock()
+	key := strings.ToLower(strings.TrimSuffix(fileDirectoryURL, "/"))
+	seen := visited[key]
+	visited[key] = true
+	mu.Unlock()
+	if seen {
+		workers.release()
+		wg.Done()
+		return
+	}
+
+	fileURLs, dirURLs := l.listDirectory(fileDirectoryURL)
+	bar.Add(len(fileURLs))
+
+	mu.Lock()
+	*allFileURLs = append(*allFileURLs, fileURLs...)
+	mu.Unlock()
+	// "Let go" of one slot/thread
+	workers.release()
+
+	if len(dirURLs) > 0 && depth >= maxListingDepth {
+		slog.Warn(fmt.Sprintf("Not listing the %d directories in %s, more than %d levels deep", len(dirURLs), fileDirectoryURL, maxListingDepth))
+	} else if len(dirURLs) > 0 {
+		slog.Debug(fmt.Sprintf("Found %d directories in %s", len(dirURLs), fileDirectoryURL))
+		for _, dirURL := range dirURLs {
+			wg.Add(1)
+			// "Take up" one slot/thread
+			workers.acquire()
+			l.getFilesFromDirNames(dirURL, depth+1, visited, allFileURLs, bar, wg, workers, mu)
+		}
+	}
+
+	// If we "Done()" before the Add it the wg could hit zero and then an Add could run and panic the Wait()
+	wg.Done()
+}
+
+// countEnumerated counts enumerated files in the report, filtered of which were not wanted
+func (l *Looter) countEnumerated(enumerated, filtered int) {
+	l.stats.countFiles(func(files *FileSummary) {
+		files.Enumerated += int64(enumerated)
+		files.Filtered += int64(filtered)
+	})
+}
+
+func (l *Looter) fileWanted(filename string) bool {
+	fileSuffix := filepath.Ext(filename)
+	// Remove the leading dot (.) from the file suffix
+	if len(fileSuffix) > 1 {
+		fileSuffix = fileSuffix[1:]
+		if l.AllowExtensions != nil && !slices.Contains(l.AllowExtensions, "all") && !slices.Contains(l.AllowExtensions, fileSuffix) {
+			slog.Debug(fmt.Sprintf("Skipping %s: %s not wanted", filename, fileSuffix))
+			return false
+		}
+	} else {
+		if l.DownloadNoExt {
+			slog.Debug(fmt.Sprintf("File %s has no file extension, downloading it!", filename))
+		} else {
+			slog.Debug(fmt.Sprintf("File %s has no file extension, and files without extensions are not being kept, skipping", filename))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package looter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestResolveFilesLoops(t *testing.T) {
+	// Every directory has a file and links to a deeper one, to the same one in another case and to another host
+	var mu sync.Mutex
+	listed := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		if strings.HasSuffix(path, ".txt/") {
+			w.Write([]byte("file"))
+			return
+		}
+		mu.Lock()
+		listed[strings.ToLower(path)]++
+		mu.Unlock()
+		fmt.Fprintf(w, `<pre> 1/2/2024  3:04 PM        5 <A HREF="%[1]sa.txt">a.txt</A><br>`+
+			` 1/2/2024  3:04 PM        &lt;dir&gt; <A HREF="%[1]sd/">d</A><br>`+
+			` 1/2/2024  3:04 PM        &lt;dir&gt; <A HREF="%[2]sD/">D</A><br>`+
+			` 1/2/2024  3:04 PM        &lt;dir&gt; <A HREF="http://attacker.invalid%[1]sd/">elsewhere</A><br></pre>`,
+			path, strings.ToUpper(path))
+	}))
+	defer ts.Close()
+
+	l, err := New(ts.URL, ts.Client(), Options{OutputDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	urls := l.ResolveFiles([]string{"ABC00001.1"})
+
+	// The package and maxListingDepth levels of directories below it, each listed once
+	if len(urls) != maxListingDepth+1 || len(listed) != maxListingDepth+1 {
+		t.Errorf("ResolveFiles() = %d URLs from %d directories, want %d", len(urls), len(listed), maxListingDepth+1)
+	}
+	for path, n := range listed {
+		if n != 1 {
+			t.Errorf("%s listed %d times, want once", path, n)
+		}
+	}
+	for _, url := range urls {
+		if !strings.HasPrefix(url, ts.URL+"/SMS_DP_SMSPKG$/ABC00001.1/") {
+			t.Errorf("ResolveFiles() returned %s", url)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package looter
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// verifyAttempts is how many times a file that does not match its INI hash is downloaded
+const verifyAttempts = 3
+
+// errCorrupt is matched by errors for downloads that do not match their expected hash
+var errCorrupt = errors.New("content does not match the expected hash")
+
+type hashMismatchError struct {
+	algorithm string
+	expected  string
+	actual    string
+}
+
+func (e *hashMismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %s, got %s", e.algorithm, e.expected, e.actual)
+}
+
+func (e *hashMismatchError) Is(target error) bool {
+	return target == errCorrupt
+}
+
+// normalizeHashAlgorithm maps the algorithm names and CryptoAPI ALG_IDs that can appear in
+// content library INIs to a hash name, returning "" if the value is not recognized
+func normalizeHashAlgorithm(value string) string {
+	switch strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(value), "-", "")) {
+	case "MD5", "32771", "0X8003":
+		return "MD5"
+	case "SHA1", "SHA", "32772", "0X8004":
+		return "SHA1"
+	case "SHA256", "32780", "0X800C":
+		return "SHA256"
+	case "SHA384", "32781", "0X800D":
+		return "SHA384"
+	case "SHA512", "32782", "0X800E":
+		return "SHA512"
+	}
+	return ""
+}
+
+// newHasher returns a hash for algorithm, or for the algorithm implied by the length of the
+// hex encoded expectedHash when algorithm is empty
+func newHasher(algorithm, expectedHash string) (hash.Hash, string, error) {
+	if algorithm == "" {
+		switch len(expectedHash) {
+		case 32:
+			algorithm = "MD5"
+		case 40:
+			algorithm = "SHA1"
+		case 64:
+			algorithm = "SHA256"
+		case 96:
+			algorithm = "SHA384"
+		case 128:
+			algorithm = "SHA512"
+		}
+	}
+	switch algorithm {
+	case "MD5":
+		return md5.New(), algorithm, nil
+	case "SHA1":
+		return sha1.New(), algorithm, nil
+	case "SHA256":
+		return sha256.New(), algorithm, nil
+	case "SHA384":
+		return sha512.New384(), algorithm, nil
+	case "SHA512":
+		return sha512.New(), algorithm, nil
+	}
+	return nil, "", fmt.Errorf("unknown hash algorithm for hash %s", expectedHash)
+}
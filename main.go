@@ -1,178 +1,458 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/k0kubun/go-ansi"
-	"github.com/schollz/progressbar/v3"
+	"sccm-http-looter/analyze"
+	"sccm-http-looter/looter"
 )
 
-var customHTTPClient http.Client
-var urlBase string
+// runConfig holds the command line options that control how a single DP is looted
+type runConfig struct {
+	datalibPath    string
+	signaturesPath string
+	urlsPath       string
+	// method is how files are found: "url", "sig" or "auto"
+	method string
+	// plan only enumerates the DP and saves what would be downloaded, executePlan downloads a saved plan
+	plan        bool
+	executePlan bool
+}
 
 func main() {
-	protocol := flag.String("protocol", "http", "The protocol (http or https)")
-	server := flag.String("server", "127.0.0.1", "The IP address or hostname of the SCCM DP")
-	port := flag.String("port", "80", "The port of the HTTP(S) server on the SCCM DP")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "probe":
+			runProbe(os.Args[2:])
+			return
+		case "discover":
+			runDiscover(os.Args[2:])
+			return
+		case "scan":
+			runScan(os.Args[2:])
+			return
+		}
+	}
+
+	targetArgs := addTargetFlags(flag.CommandLine)
+	clientArgs := addClientFlags(flag.CommandLine)
 	outputDir := flag.String("output", "./loot", "The base output directory for files related to this DP")
 	fileAllowList := flag.String("allow", "ps1,vbs,txt,cmd,bat,pfx,pem,cer,certs,expect,sql,xml,ps1xml,config,ini,ksh,sh,rsh,py,keystore,reg,yml,yaml,token,script,sqlite,plist,au3,cfg", "A comma-separated list of file extensions (no dot) to allow. Use 'all' to allow all file types")
-	numThreads := flag.Int("threads", 1, "Number of threads (goroutines) for concurrent downloading")
-	validate := flag.Bool("validate", false, "Validate HTTPS certificates")
+	numThreads := flag.Int("threads", 1, "Number of threads (goroutines) for concurrent downloading, per DP")
+	globalThreads := flag.Int("global-threads", 0, "Maximum number of concurrent requests across all DPs (0 for no limit beyond -threads per DP)")
+	parallelTargets := flag.Int("parallel-targets", 4, "Number of DPs from -targets looted at the same time")
 	datalibPath := flag.String("datalib", "", "Path to a DataLib directory listing download (for cases where the listing cannot be retrieved with this tool)")
 	signaturesPath := flag.String("signatures", "", "Path to a directory containing .tar signatures (for cases where you want to reprocess a server without having to re-download signatures)")
 	downloadNoExt := flag.Bool("downloadnoext", false, "Download files without a file extension")
-	userAgent := flag.String("useragent", "sccm-http-looter", "User agent to use for all requests")
-	httpTimeout := flag.String("timeout", "10s", "HTTP timeout value, use a number + 'ms', 's', 'm', or 'h' for values")
 	randomize := flag.Bool("randomize", false, "randomize the order of requests for signatures and files")
 	verbose := flag.Bool("verbose", false, "print debug/error statements")
-	signatureMethod := flag.Bool("use-signature-method", false, "get filenames from signature files")
+	signatureMethod := flag.Bool("use-signature-method", false, "get filenames from signature files (same as -method sig)")
+	method := flag.String("method", "url", "How to find files: 'url' to browse the package directory listings, 'sig' to read file names from signature files, or 'auto' to probe each DP and use what works (both if possible)")
+	rate := flag.Float64("rate", 0, "Maximum requests per second to each DP (0 for no limit)")
+	bandwidth := flag.String("bandwidth", "0", "Maximum bytes per second downloaded from each DP, with an optional K, M or G suffix (0 for no limit)")
+	globalRate := flag.Float64("global-rate", 0, "Maximum requests per second across all DPs (0 for no limit)")
+	globalBandwidth := flag.String("global-bandwidth", "0", "Maximum bytes per second downloaded across all DPs, with an optional K, M or G suffix (0 for no limit)")
+	adaptive := flag.Bool("adaptive", false, "Lower the request rate of a DP when it slows down or answers 429 or 503, then raise it back up to -rate")
+	retries := flag.Int("retries", 2, "Number of times a request is retried after a transient failure (timeout, reset connection, short read or a -retry-status code)")
+	retryDelay := flag.String("retry-delay", "1s", "Delay before the first retry, doubled for each following retry (with jitter) unless the DP sends a longer Retry-After")
+	retryMaxDelay := flag.String("retry-max-delay", "30s", "Maximum delay between two retries")
+	retryStatuses := flag.String("retry-status", "429,500,502,503,504", "Comma-separated HTTP status codes that are retried, other errors such as 404 or 403 are permanent")
+	resume := flag.Bool("resume", false, "Resume a previous run into the same output directory, skipping the work recorded as completed in its state.jsonl")
+	layout := flag.String("layout", looter.LayoutExtension, "Output layout for files: 'ext' for files/<ext>/<hash>_<method>_<name>, or 'tree' to recreate files/<content ID>/<relative path>")
+	store := flag.Bool("store", false, "Save each unique file once in a content store (<output>/store) keyed by its full hash, shared by all DPs in the run and later runs")
+	linkMode := flag.String("link", looter.LinkHard, "How -store files are placed in files/<ext>/: hard, symlink, copy or none")
+	plan := flag.Bool("plan", false, "Dry run: enumerate the DP (Datalib, signatures or directory listings), then print and save to <output>/plan.json the files that would be downloaded, without downloading them")
+	executePlan := flag.Bool("execute-plan", false, "Download exactly the files of the plan saved in <output>/plan.json by a previous -plan run")
+	scan := flag.Bool("scan", false, "Scan every downloaded file for credentials and secrets, saving what is found to <output>/"+analyze.FindingsFileName)
+	passwordsPath := flag.String("passwords", "", "Path to a file of passwords to try on the PKCS#12 files and Java key stores downloaded, one per line, after the common ones")
 	urlsPath := flag.String("urlsPath", "", "Path to a file containing URLs (for cases where you want to reprocess downloads without re-scraping the URLs)")
 
 	flag.Parse()
 
 	slog.Info("SCCM HTTP Looter by Bad Sector Labs (@badsectorlabs)")
 
-	allowExtensions := strings.Split(*fileAllowList, ",")
+	if *verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
 
-	customHTTPClient = createCustomHTTPClient(*userAgent, !*validate, *httpTimeout)
+	retryPolicy, err := parseRetryPolicy(*retries, *retryDelay, *retryMaxDelay, *retryStatuses)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	bytesPerSecond, err := parseByteRate(*bandwidth)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Invalid -bandwidth value: %s", *bandwidth))
+		os.Exit(1)
+	}
+	globalBytesPerSecond, err := parseByteRate(*globalBandwidth)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Invalid -global-bandwidth value: %s", *globalBandwidth))
+		os.Exit(1)
+	}
+	if *adaptive && *rate <= 0 {
+		slog.Error("-adaptive needs a maximum rate, set with -rate")
+		os.Exit(1)
+	}
 
-	urlBase = fmt.Sprintf("%s://%s:%s", *protocol, *server, *port)
+	cfg := runConfig{
+		datalibPath:    *datalibPath,
+		signaturesPath: *signaturesPath,
+		urlsPath:       *urlsPath,
+		method:         *method,
+		plan:           *plan,
+		executePlan:    *executePlan,
+	}
+	if *signatureMethod {
+		cfg.method = "sig"
+	}
+	if cfg.method != "url" && cfg.method != "sig" && cfg.method != "auto" {
+		slog.Error(fmt.Sprintf("Invalid -method value: %s", cfg.method))
+		os.Exit(1)
+	}
+	if cfg.plan && cfg.executePlan {
+		slog.Error("-plan and -execute-plan cannot be used together")
+		os.Exit(1)
+	}
 
-	if *verbose {
-		slog.SetLogLoggerLevel(slog.LevelDebug)
+	// Get the base URL of every DP to loot
+	targets, err := targetArgs.targets()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if *targetArgs.targetsPath != "" {
+		if cfg.datalibPath != "" || cfg.signaturesPath != "" || cfg.urlsPath != "" {
+			slog.Error("-datalib, -signatures and -urlsPath cannot be used with -targets")
+			os.Exit(1)
+		}
+		slog.Info(fmt.Sprintf("Looting %d DPs from %s", len(targets), *targetArgs.targetsPath))
+	}
+
+	clientConfig, err := clientArgs.config(targets)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	credentials := clientConfig.Credentials != nil
+	client, err := looter.NewHTTPClient(clientConfig)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Unable to create HTTP client: %v", err))
+		os.Exit(1)
+	}
+	if *layout != looter.LayoutExtension && *layout != looter.LayoutTree {
+		slog.Error(fmt.Sprintf("Invalid -layout value: %s", *layout))
+		os.Exit(1)
+	}
+
+	var contentStore *looter.ContentStore
+	if *store {
+		switch *linkMode {
+		case looter.LinkHard, looter.LinkSymlink, looter.LinkCopy, looter.LinkNone:
+		default:
+			slog.Error(fmt.Sprintf("Invalid -link value: %s", *linkMode))
+			os.Exit(1)
+		}
+		contentStore, err = looter.OpenStore(filepath.Join(*outputDir, "store"))
+		if err != nil {
+			slog.Error(fmt.Sprintf("Unable to open content store: %v", err))
+			os.Exit(1)
+		}
+		defer contentStore.Close()
+	}
+	opts := looter.Options{
+		AllowExtensions:   strings.Split(*fileAllowList, ","),
+		DownloadNoExt:     *downloadNoExt,
+		Threads:           *numThreads,
+		Randomize:         *randomize,
+		Global:            looter.NewBudget(*globalThreads),
+		Resume:            *resume,
+		Layout:            *layout,
+		Store:             contentStore,
+		Link:              *linkMode,
+		Retry:             retryPolicy,
+		RequestsPerSecond: *rate,
+		BytesPerSecond:    bytesPerSecond,
+		Adaptive:          *adaptive,
+		GlobalRate:        looter.NewRateLimit(*globalRate, globalBytesPerSecond, false),
+		// Progress bars from concurrent DPs would overwrite each other
+		HideProgress: len(targets) > 1,
+	}
+
+	var scanner *analyze.Scanner
+	if *scan {
+		scanner = analyze.NewScanner()
+	}
+	passwords, err := readPasswords(*passwordsPath)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Loot -parallel-targets DPs at a time, the worker budget limits the total load
+	outcomes := make([]string, len(targets))
+	errs := make([]error, len(targets))
+	slots := make(chan struct{}, max(*parallelTargets, 1))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		// The Datalib, journal and progress of a DP are only opened once it has a slot
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, target string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			targetOpts := opts
+			targetOpts.OutputDir = *outputDir
+			if *targetArgs.targetsPath != "" {
+				targetOpts.OutputDir = filepath.Join(*outputDir, looter.TargetDirName(target))
+			}
+			// Every file is analyzed for credentials, deployments and key material, and scanned for secrets with -scan
+			analysis := newAnalysis(scanner, passwords, filepath.Join(targetOpts.OutputDir, analyze.FindingsFileName), *resume)
+			defer func() {
+				if err := analysis.Close(); err != nil {
+					slog.Error(fmt.Sprintf("Error writing findings: %v", err))
+				}
+			}()
+			targetOpts.OnDownload = analysis.onDownload
+			l, err := looter.New(target, client, targetOpts)
+			if err != nil {
+				outcomes[i], errs[i] = looter.OutcomeFailed, err
+				return
+			}
+			defer l.Close()
+			if credentials {
+				// The DP answers 401s with credentials, so its NTLM challenge is not seen otherwise
+				if _, err := l.ProbeNTLM(); err != nil {
+					slog.Debug(fmt.Sprintf("Error probing %s for an NTLM challenge: %v", l.BaseURL, err))
+				}
+			}
+			errs[i] = lootTarget(l, cfg)
+			report := l.Report(errs[i])
+			outcomes[i] = report.Outcome
+			if report.Requests.Transient+report.Requests.Permanent > 0 {
+				slog.Warn(fmt.Sprintf("%s: %d requests failed permanently (i.e. 404 or 403) and %d failed after %d attempts, see %s", l.BaseURL, report.Requests.Permanent, report.Requests.Transient, l.Retry.MaxAttempts, filepath.Join(l.OutputDir, looter.ReportFileName)))
+			}
+			if err := writeReport(report, l.OutputDir); err != nil {
+				slog.Error(fmt.Sprintf("Error writing report: %v", err))
+			}
+		}(i, target)
+	}
+	wg.Wait()
+
+	// The exit code is 1 if a DP could not be looted, 2 if files are missing from a DP and 0 otherwise
+	exitCode := 0
+	looted := 0
+	for i, target := range targets {
+		switch outcomes[i] {
+		case looter.OutcomeFailed:
+			exitCode = 1
+			slog.Error(fmt.Sprintf("%s: %v", target, errs[i]))
+		case looter.OutcomePartial:
+			if exitCode == 0 {
+				exitCode = 2
+			}
+			looted++
+			slog.Warn(fmt.Sprintf("%s: looted, but some signatures, listings or files could not be downloaded", target))
+		default:
+			looted++
+			if len(targets) > 1 {
+				slog.Info(fmt.Sprintf("%s: looted", target))
+			}
+		}
+	}
+	if len(targets) > 1 {
+		slog.Info(fmt.Sprintf("Looted %d of %d DPs", looted, len(targets)))
+	}
+
+	slog.Info("SCCM Looting complete!")
+	os.Exit(exitCode)
+}
+
+// lootTarget gets the Datalib of a single DP, then finds and downloads files with the configured method
+func lootTarget(l *looter.Looter, cfg runConfig) error {
+	planPath := filepath.Join(l.OutputDir, looter.PlanFileName)
+	if cfg.executePlan {
+		plan, err := looter.LoadPlan(planPath)
+		if err != nil {
+			return err
+		}
+		slog.Info(fmt.Sprintf("Executing plan %s: %d files from %s", planPath, len(plan.Files), l.BaseURL))
+		return l.ExecutePlan(plan)
 	}
 
 	// Get the DataLib HTML content from the server or from disk
 	var datalibBody string
-	if *datalibPath == "" {
+	if cfg.datalibPath == "" {
 		var err error
-		datalibBody, err = getDatalibListing(*server, *outputDir)
+		datalibBody, err = l.ListDatalib()
 		if err != nil {
-			if strings.Contains(err.Error(), "401") {
-				writeStringArrayToFile(filepath.Join(*outputDir, "401"), []string{})
-			} else if strings.Contains(err.Error(), "404") {
-				writeStringArrayToFile(filepath.Join(*outputDir, "404"), []string{})
-			} else if strings.Contains(err.Error(), "error reading response body") {
-				writeStringArrayToFile(filepath.Join(*outputDir, "body error"), []string{})
-			}
-			return
+			return err
 		}
 	} else {
-		content, err := os.ReadFile(*datalibPath)
+		content, err := os.ReadFile(cfg.datalibPath)
 		if err != nil {
-			slog.Error(fmt.Sprintf("Unable to read file: %s", *datalibPath))
-			return
+			return fmt.Errorf("unable to read file: %s", cfg.datalibPath)
 		}
 		datalibBody = string(content)
 	}
-	fileNames := extractFileNames(datalibBody)
+	fileNames := looter.ParseDatalib(datalibBody)
+
+	method := cfg.method
+	if method == "auto" {
+		var err error
+		method, err = chooseMethod(l, fileNames, cfg)
+		if err != nil {
+			return err
+		}
+	}
+	if method == "both" {
+		l.DownloadCombined(fileNames)
+		return nil
+	}
+
 	// Use the filenames from Datalib to pull down signature files, parse them, and finally download files
-	if *signatureMethod {
+	if method == "sig" {
 		// Get all the signature files from the server, or a gather a list from disk
 		var filePaths []string
-		if *signaturesPath == "" {
-			getSignatures(*outputDir, fileNames, *numThreads, *randomize)
-			filePaths = walkDir(filepath.Join(*outputDir, "signatures"))
-			if filePaths == nil {
-				slog.Error("No signature files found!")
-				return
+		if cfg.signaturesPath == "" {
+			filePaths = l.FetchSignatures(fileNames)
+			if len(filePaths) == 0 {
+				return errors.New("no signature files found")
 			}
 		} else {
-			filePaths = walkDir(*signaturesPath)
-		}
-
-		if *randomize {
-			randomizeStrings(filePaths)
-		}
-
-		bar := progressbar.NewOptions(len(filePaths),
-			progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowBytes(false),
-			progressbar.OptionShowCount(),
-			progressbar.OptionShowElapsedTimeOnFinish(),
-			progressbar.OptionSetWidth(30),
-			progressbar.OptionSetDescription("[cyan][2/2][reset] Getting files..."),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}))
-
-		totalFiles := 0
-		// Get all the file names from every signature, then download the INI and finally the binary
-		for _, filePath := range filePaths {
-			bar.Add(1)
-
-			fileNames, err := getFileNamesFromSignatureFile(filePath)
+			filePaths = looter.SignatureFiles(cfg.signaturesPath)
+		}
+		if cfg.plan {
+			plan, err := l.PlanSignatures(filePaths)
 			if err != nil {
-				slog.Error("Error:", err)
-				continue
+				return err
 			}
-			// Save filenames to disk
-			writeStringArrayToFile(filepath.Join(*outputDir, *server+"_files.txt"), fileNames)
-			totalFiles += len(fileNames)
-			// Download all the wanted files
-			downloadFiles(*outputDir, filePath, fileNames, allowExtensions, *downloadNoExt, *numThreads, *randomize)
+			return savePlan(plan, planPath)
 		}
-		bar.Finish()
+		l.DownloadFromSignatures(filePaths)
 	} else { // URL method
 		// Just use the datalib to loop over directories and look for files directly
-		slog.Info(fmt.Sprintf("Found %d Directories in the Datalib", len(fileNames)))
-		if *urlsPath == "" {
-			allFileURLs := getAllFileURLsFromDirNames(fileNames, *numThreads, *randomize)
-			writeStringArrayToFile(filepath.Join(*outputDir, *server+"_urls.txt"), allFileURLs)
+		slog.Info(fmt.Sprintf("Found %d Directories in the Datalib of %s", len(fileNames), l.BaseURL))
+		var allFileURLs []string
+		if cfg.urlsPath == "" {
+			allFileURLs = l.ResolveFiles(fileNames)
 		} else {
-			slog.Info(fmt.Sprintf("Using provided URLs file: %s", *urlsPath))
-			content, err := os.ReadFile(*urlsPath)
-			if err != nil {
-				slog.Error(fmt.Sprintf("Unable to read file: %s", *urlsPath))
-				return
-			}
-			allFileURLs = strings.Split(string(content), "\n")
-		}
-		bar := progressbar.NewOptions(len(allFileURLs),
-			progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowBytes(false),
-			progressbar.OptionShowCount(),
-			progressbar.OptionShowElapsedTimeOnFinish(),
-			progressbar.OptionSetWidth(30),
-			progressbar.OptionSetDescription("[cyan][2/2][reset] Getting files..."),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}))
-		var wg sync.WaitGroup
-		wg.Add(len(allFileURLs))
-
-		// Create a channel to limit the number of concurrent downloads
-		semaphore := make(chan struct{}, *numThreads)
-
-		for _, fileURL := range allFileURLs {
-			bar.Add(1)
-			wanted, outputDir := fileWanted(allowExtensions, *downloadNoExt, extractFileName(fileURL), *outputDir)
-			if wanted {
-				// Add an empty struct to the semaphore channel to "take up" one slot/thread
-				semaphore <- struct{}{}
-				go downloadFileFromURLAsHashName(fileURL, outputDir, &wg, semaphore)
+			slog.Info(fmt.Sprintf("Using provided URLs file: %s", cfg.urlsPath))
+			var err error
+			if allFileURLs, err = looter.ReadLines(cfg.urlsPath); err != nil {
+				return fmt.Errorf("unable to read file: %s", cfg.urlsPath)
 			}
 		}
-		bar.Finish()
+		if cfg.plan {
+			return savePlan(l.PlanURLs(allFileURLs), planPath)
+		}
+		l.DownloadURLs(allFileURLs)
 	}
+	return nil
+}
 
-	slog.Info("SCCM Looting complete!")
+// parseRetryPolicy builds the retry policy from the -retries, -retry-delay, -retry-max-delay and -retry-status values
+func parseRetryPolicy(retries int, delay, maxDelay, statuses string) (looter.RetryPolicy, error) {
+	policy := looter.RetryPolicy{MaxAttempts: retries + 1}
+	if retries < 0 {
+		return policy, fmt.Errorf("invalid -retries value: %d", retries)
+	}
+	var err error
+	if policy.BaseDelay, err = time.ParseDuration(delay); err != nil {
+		return policy, fmt.Errorf("unable to parse -retry-delay value: %s", delay)
+	}
+	if policy.MaxDelay, err = time.ParseDuration(maxDelay); err != nil {
+		return policy, fmt.Errorf("unable to parse -retry-max-delay value: %s", maxDelay)
+	}
+	for _, status := range strings.Split(statuses, ",") {
+		status = strings.TrimSpace(status)
+		if status == "" {
+			continue
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return policy, fmt.Errorf("invalid -retry-status code: %s", status)
+		}
+		policy.RetryStatuses = append(policy.RetryStatuses, code)
+	}
+	return policy, nil
+}
 
+// parseByteRate parses a number of bytes with an optional K, M or G (binary) suffix
+func parseByteRate(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G"} {
+		if strings.HasSuffix(value, suffix) {
+			multiplier = 1 << (10 * (i + 1))
+			value = strings.TrimSuffix(value, suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte rate: %s", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// chooseMethod probes the DP for directory listing and signatures and returns the method to use,
+// "both" if they both work
+func chooseMethod(l *looter.Looter, fileNames []string, cfg runConfig) (string, error) {
+	support := l.ProbeMethods(fileNames)
+	method := ""
+	switch {
+	case support.Listing && support.Signatures && cfg.urlsPath != "":
+		method = "url"
+	case support.Listing && support.Signatures && (cfg.plan || cfg.signaturesPath != ""):
+		// Plans only use a single method, signatures tell more about each file
+		method = "sig"
+	case support.Listing && support.Signatures:
+		method = "both"
+	case support.Signatures:
+		method = "sig"
+	case support.Listing:
+		method = "url"
+	default:
+		return "", errors.New("neither directory listing nor signatures are available")
+	}
+	slog.Info(fmt.Sprintf("%s: directory listing %s, signatures %s, using %s", l.BaseURL, available(support.Listing), available(support.Signatures), method))
+	return method, nil
+}
+
+// available describes whether a method works
+func available(ok bool) string {
+	if ok {
+		return "available"
+	}
+	return "unavailable"
+}
+
+// savePlan prints plan and saves it to planPath
+func savePlan(plan *looter.Plan, planPath string) error {
+	if err := plan.Save(planPath); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("Plan saved to %s, run again with -execute-plan to download it\n%s", planPath, plan.Summary()))
+	return nil
+}
+
+// writeReport saves report to the output directory of its DP
+func writeReport(report *looter.Report, outputDir string) error {
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return err
+	}
+	return report.Save(filepath.Join(outputDir, looter.ReportFileName))
 }
@@ -0,0 +1,330 @@
+// Package ntlm implements the client side of the NTLMv2 authentication handshake
+// (MS-NLMP) used by IIS for Windows authentication.
+package ntlm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+var signature = []byte("NTLMSSP\x00")
+
+// Negotiate flags, see MS-NLMP 2.2.2.5
+const (
+	negotiateUnicode                 = 0x00000001
+	negotiateOEM                     = 0x00000002
+	requestTarget                    = 0x00000004
+	negotiateNTLM                    = 0x00000200
+	negotiateAlwaysSign              = 0x00008000
+	negotiateExtendedSessionSecurity = 0x00080000
+	negotiateTargetInfo              = 0x00800000
+	negotiateVersion                 = 0x02000000
+	negotiate128                     = 0x20000000
+	negotiate56                      = 0x80000000
+)
+
+const defaultFlags = negotiateUnicode | negotiateOEM | requestTarget | negotiateNTLM | negotiateAlwaysSign |
+	negotiateExtendedSessionSecurity | negotiate128 | negotiate56
+
+// AV_PAIR IDs found in the target info of a challenge, see MS-NLMP 2.2.2.1
+const (
+	avEOL             = 0x0000
+	avNbComputerName  = 0x0001
+	avNbDomainName    = 0x0002
+	avDNSComputerName = 0x0003
+	avDNSDomainName   = 0x0004
+	avDNSTreeName     = 0x0005
+	avTimestamp       = 0x0007
+)
+
+// negotiateMessageVersion is the VERSION sent in negotiate messages, Windows 10 with NTLMSSP revision 15
+var negotiateMessageVersion = []byte{10, 0, 0x61, 0x4a, 0, 0, 0, 15}
+
+// ChallengeMessage is the server's response (Type 2) to a negotiate message
+type ChallengeMessage struct {
+	Flags           uint32
+	ServerChallenge [8]byte
+	TargetName      string
+	// TargetInfo is the raw AV_PAIR list, it is echoed back in the NTLMv2 response
+	TargetInfo []byte
+	// Version is the OS version of the server, nil if it did not send one
+	Version *Version
+}
+
+// Version is the VERSION structure of a message, see MS-NLMP 2.2.2.10
+type Version struct {
+	Major    uint8
+	Minor    uint8
+	Build    uint16
+	Revision uint8
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Build)
+}
+
+// ServerInfo is what a server discloses about itself in a challenge message
+type ServerInfo struct {
+	TargetName          string `json:"target_name,omitempty"`
+	NetBIOSComputerName string `json:"netbios_computer_name,omitempty"`
+	NetBIOSDomainName   string `json:"netbios_domain_name,omitempty"`
+	DNSComputerName     string `json:"dns_computer_name,omitempty"`
+	DNSDomainName       string `json:"dns_domain_name,omitempty"`
+	// DNSTreeName is the forest of the domain
+	DNSTreeName string `json:"dns_tree_name,omitempty"`
+	// Timestamp is the clock of the server
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	// OSVersion is the Windows version, i.e. 10.0.17763 for Server 2019
+	OSVersion    string `json:"os_version,omitempty"`
+	NTLMRevision uint8  `json:"ntlm_revision,omitempty"`
+}
+
+// NTHash returns the NT hash of password, the MD4 of its UTF-16LE encoding
+func NTHash(password string) []byte {
+	hash := md4.New()
+	hash.Write(utf16le(password))
+	return hash.Sum(nil)
+}
+
+// NegotiateMessage returns the Type 1 message that starts a handshake. It asks for the version
+// of the server, which is only used by ServerInfo.
+func NegotiateMessage() []byte {
+	msg := make([]byte, 40)
+	copy(msg, signature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], defaultFlags|negotiateVersion)
+	// The domain and workstation fields are left empty
+	copy(msg[32:], negotiateMessageVersion)
+	return msg
+}
+
+// ParseChallengeMessage decodes a Type 2 message
+func ParseChallengeMessage(msg []byte) (*ChallengeMessage, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], signature) {
+		return nil, errors.New("not an NTLM message")
+	}
+	if binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("not an NTLM challenge message")
+	}
+
+	c := &ChallengeMessage{
+		Flags: binary.LittleEndian.Uint32(msg[20:]),
+	}
+	copy(c.ServerChallenge[:], msg[24:32])
+
+	targetName, err := readField(msg, 12)
+	if err != nil {
+		return nil, err
+	}
+	if c.Flags&negotiateUnicode != 0 {
+		c.TargetName = fromUTF16le(targetName)
+	} else {
+		c.TargetName = string(targetName)
+	}
+
+	if c.Flags&negotiateTargetInfo != 0 && len(msg) >= 48 {
+		c.TargetInfo, err = readField(msg, 40)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The version comes before the payload, which starts at 48 without it
+	if c.Flags&negotiateVersion != 0 && len(msg) >= 56 && payloadOffset(msg) >= 56 {
+		c.Version = &Version{
+			Major:    msg[48],
+			Minor:    msg[49],
+			Build:    binary.LittleEndian.Uint16(msg[50:]),
+			Revision: msg[55],
+		}
+	}
+	return c, nil
+}
+
+// payloadOffset returns where the payload of a challenge message starts, the smallest offset of its fields
+func payloadOffset(msg []byte) int {
+	offset := len(msg)
+	for _, pos := range []int{12, 40} {
+		if len(msg) >= pos+8 && binary.LittleEndian.Uint16(msg[pos:]) > 0 {
+			offset = min(offset, int(binary.LittleEndian.Uint32(msg[pos+4:])))
+		}
+	}
+	return offset
+}
+
+// ServerInfo decodes the names, clock and version of the server from the challenge
+func (c *ChallengeMessage) ServerInfo() *ServerInfo {
+	info := &ServerInfo{TargetName: c.TargetName}
+	names := map[uint16]*string{
+		avNbComputerName:  &info.NetBIOSComputerName,
+		avNbDomainName:    &info.NetBIOSDomainName,
+		avDNSComputerName: &info.DNSComputerName,
+		avDNSDomainName:   &info.DNSDomainName,
+		avDNSTreeName:     &info.DNSTreeName,
+	}
+	for id, name := range names {
+		if value, ok := avPairValue(c.TargetInfo, id); ok {
+			*name = fromUTF16le(value)
+		}
+	}
+	if value, ok := avTimestampValue(c.TargetInfo); ok {
+		timestamp := fromFileTime(binary.LittleEndian.Uint64(value))
+		info.Timestamp = &timestamp
+	}
+	if c.Version != nil {
+		info.OSVersion = c.Version.String()
+		info.NTLMRevision = c.Version.Revision
+	}
+	return info
+}
+
+// AuthenticateMessage returns the Type 3 message answering challenge with an NTLMv2 response
+func AuthenticateMessage(challenge *ChallengeMessage, domain, user string, ntHash []byte) ([]byte, error) {
+	if len(ntHash) != 16 {
+		return nil, errors.New("NT hash must be 16 bytes")
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	// Use the server's timestamp when it sends one, as required by MS-NLMP 3.1.5.1.2
+	timestamp, serverTimestamp := avTimestampValue(challenge.TargetInfo)
+	if !serverTimestamp {
+		timestamp = make([]byte, 8)
+		binary.LittleEndian.PutUint64(timestamp, fileTime(time.Now()))
+	}
+
+	ntResponse, lmResponse := ntlmv2Responses(challenge, ntowfv2(ntHash, user, domain), clientChallenge, timestamp)
+	// The LMv2 response is zeroed when the server sent a timestamp
+	if serverTimestamp {
+		lmResponse = make([]byte, 24)
+	}
+
+	flags := challenge.Flags & defaultFlags
+	flags |= negotiateUnicode
+
+	fields := [][]byte{lmResponse, ntResponse, utf16le(domain), utf16le(user), nil, nil}
+	const headerSize = 64
+	msg := make([]byte, headerSize)
+	copy(msg, signature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := headerSize
+	for i, field := range fields {
+		// Each field is described by a length, max length and offset into the payload
+		binary.LittleEndian.PutUint16(msg[12+i*8:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[14+i*8:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[16+i*8:], uint32(offset))
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], flags)
+	for _, field := range fields {
+		msg = append(msg, field...)
+	}
+	return msg, nil
+}
+
+// ntowfv2 returns the NTLMv2 response key of user, see MS-NLMP 3.3.2
+func ntowfv2(ntHash []byte, user, domain string) []byte {
+	return hmacMD5(ntHash, utf16le(strings.ToUpper(user)+domain))
+}
+
+// ntlmv2Responses returns the NTLMv2 response (NTProofStr followed by the client challenge structure)
+// and the LMv2 response to challenge, see MS-NLMP 3.3.2
+func ntlmv2Responses(challenge *ChallengeMessage, ntowfv2, clientChallenge, timestamp []byte) ([]byte, []byte) {
+	// NTLMv2_CLIENT_CHALLENGE, see MS-NLMP 2.2.2.7
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, challenge.TargetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	ntProof := hmacMD5(ntowfv2, append(challenge.ServerChallenge[:], temp...))
+	lmResponse := append(hmacMD5(ntowfv2, append(challenge.ServerChallenge[:], clientChallenge...)), clientChallenge...)
+	return append(ntProof, temp...), lmResponse
+}
+
+// readField returns the payload referenced by the length/offset structure at pos
+func readField(msg []byte, pos int) ([]byte, error) {
+	if len(msg) < pos+8 {
+		return nil, errors.New("NTLM message too short")
+	}
+	length := int(binary.LittleEndian.Uint16(msg[pos:]))
+	offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+	if length == 0 {
+		return nil, nil
+	}
+	if offset < 0 || offset+length > len(msg) {
+		return nil, errors.New("NTLM message field out of bounds")
+	}
+	return msg[offset : offset+length], nil
+}
+
+// avTimestampValue returns the MsvAvTimestamp from target info, if there is one
+func avTimestampValue(targetInfo []byte) ([]byte, bool) {
+	value, ok := avPairValue(targetInfo, avTimestamp)
+	if !ok || len(value) != 8 {
+		return nil, false
+	}
+	return value, true
+}
+
+// avPairValue returns the value of the AV_PAIR with id from target info, if there is one
+func avPairValue(targetInfo []byte, avID uint16) ([]byte, bool) {
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if id == avEOL || len(targetInfo) < 4+length {
+			break
+		}
+		if id == avID {
+			return targetInfo[4 : 4+length], true
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+	return nil, false
+}
+
+func hmacMD5(key, data []byte) []byte {
+	mac := hmac.New(md5.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// fileTime converts t to a Windows FILETIME, the number of 100ns intervals since 1601-01-01
+func fileTime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+// fromFileTime converts a Windows FILETIME to a time
+func fromFileTime(ft uint64) time.Time {
+	return time.Unix(0, int64(ft-116444736000000000)*100).UTC()
+}
+
+func utf16le(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	b := make([]byte, len(encoded)*2)
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(b[i*2:], r)
+	}
+	return b
+}
+
+func fromUTF16le(b []byte) string {
+	encoded := make([]uint16, len(b)/2)
+	for i := range encoded {
+		encoded[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(encoded))
+}
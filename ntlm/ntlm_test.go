@@ -0,0 +1,216 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// The values of MS-NLMP 4.2.1 and 4.2.4 (NTLMv2 authentication)
+const (
+	specUser     = "User"
+	specDomain   = "Domain"
+	specPassword = "Password"
+)
+
+var (
+	specServerChallenge = []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	specClientChallenge = bytes.Repeat([]byte{0xaa}, 8)
+	specTimestamp       = make([]byte, 8)
+)
+
+// specChallengeMessage is the CHALLENGE_MESSAGE of MS-NLMP 4.2.4.3
+var specChallengeMessage = mustHex("4e544c4d53535000020000000c000c003800000033828ae20123456789abcdef" +
+	"00000000000000002400240044000000060070170000000f53006500720076006500720002000c0044006f006d00" +
+	"610069006e0001000c0053006500720076006500720000000000")
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestNTHash(t *testing.T) {
+	// MS-NLMP 4.2.2.1.2
+	want := mustHex("a4f49c406510bdcab6824ee7c30fd852")
+	if got := NTHash(specPassword); !bytes.Equal(got, want) {
+		t.Errorf("NTHash(%q) = %x, want %x", specPassword, got, want)
+	}
+}
+
+func TestNTLMv2Responses(t *testing.T) {
+	challenge, err := ParseChallengeMessage(specChallengeMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MS-NLMP 4.2.4.1.1
+	key := ntowfv2(NTHash(specPassword), specUser, specDomain)
+	if want := mustHex("0c868a403bfd7a93a3001ef22ef02e3f"); !bytes.Equal(key, want) {
+		t.Errorf("NTOWFv2 = %x, want %x", key, want)
+	}
+
+	// MS-NLMP 4.2.4.2.1 and 4.2.4.2.2
+	ntResponse, lmResponse := ntlmv2Responses(challenge, key, specClientChallenge, specTimestamp)
+	if want := mustHex("86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa"); !bytes.Equal(lmResponse, want) {
+		t.Errorf("LMv2 response = %x, want %x", lmResponse, want)
+	}
+	if want := mustHex("68cd0ab851e51c96aabc927bebef6a1c"); !bytes.Equal(ntResponse[:16], want) {
+		t.Errorf("NTProofStr = %x, want %x", ntResponse[:16], want)
+	}
+	if !bytes.HasSuffix(ntResponse, append(challenge.TargetInfo, 0, 0, 0, 0)) {
+		t.Errorf("NTLMv2 response %x does not end with the target info", ntResponse)
+	}
+}
+
+func TestParseChallengeMessage(t *testing.T) {
+	challenge, err := ParseChallengeMessage(specChallengeMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Flags != 0xe28a8233 {
+		t.Errorf("Flags = %#x, want 0xe28a8233", challenge.Flags)
+	}
+	if !bytes.Equal(challenge.ServerChallenge[:], specServerChallenge) {
+		t.Errorf("ServerChallenge = %x, want %x", challenge.ServerChallenge, specServerChallenge)
+	}
+	if challenge.TargetName != "Server" {
+		t.Errorf("TargetName = %q, want Server", challenge.TargetName)
+	}
+	if challenge.Version == nil || challenge.Version.String() != "6.0.6000" || challenge.Version.Revision != 15 {
+		t.Errorf("Version = %+v, want 6.0.6000 revision 15", challenge.Version)
+	}
+	info := challenge.ServerInfo()
+	if info.NetBIOSDomainName != "Domain" || info.NetBIOSComputerName != "Server" || info.Timestamp != nil {
+		t.Errorf("ServerInfo() = %+v", info)
+	}
+}
+
+func TestParseChallengeMessageRoundTrip(t *testing.T) {
+	timestamp := make([]byte, 8)
+	binary.LittleEndian.PutUint64(timestamp, 133000000000000000)
+	want := &ChallengeMessage{
+		Flags:           defaultFlags | negotiateTargetInfo | negotiateVersion,
+		ServerChallenge: [8]byte{8, 7, 6, 5, 4, 3, 2, 1},
+		TargetName:      "CORP",
+		TargetInfo: avPairs(map[uint16]string{
+			avNbDomainName:    "CORP",
+			avNbComputerName:  "SCCM01",
+			avDNSDomainName:   "corp.local",
+			avDNSComputerName: "sccm01.corp.local",
+			avDNSTreeName:     "corp.local",
+		}, timestamp),
+		Version: &Version{Major: 10, Minor: 0, Build: 17763, Revision: 15},
+	}
+
+	got, err := ParseChallengeMessage(encodeChallenge(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Flags != want.Flags || got.ServerChallenge != want.ServerChallenge || got.TargetName != want.TargetName ||
+		!bytes.Equal(got.TargetInfo, want.TargetInfo) || got.Version == nil || *got.Version != *want.Version {
+		t.Errorf("ParseChallengeMessage(encodeChallenge(%+v)) = %+v", want, got)
+	}
+	info := got.ServerInfo()
+	if info.DNSComputerName != "sccm01.corp.local" || info.DNSTreeName != "corp.local" || info.OSVersion != "10.0.17763" ||
+		info.Timestamp == nil || fileTime(*info.Timestamp) != 133000000000000000 {
+		t.Errorf("ServerInfo() = %+v", info)
+	}
+}
+
+func TestParseChallengeMessageInvalid(t *testing.T) {
+	truncated := bytes.Clone(specChallengeMessage)
+	// Target info past the end of the message
+	binary.LittleEndian.PutUint32(truncated[44:], uint32(len(truncated)))
+
+	for name, msg := range map[string][]byte{
+		"empty":        nil,
+		"signature":    append([]byte("NTLMSSX\x00"), specChallengeMessage[8:]...),
+		"negotiate":    NegotiateMessage(),
+		"out of range": truncated,
+	} {
+		if _, err := ParseChallengeMessage(msg); err == nil {
+			t.Errorf("ParseChallengeMessage(%s) succeeded", name)
+		}
+	}
+}
+
+func TestAuthenticateMessage(t *testing.T) {
+	challenge, err := ParseChallengeMessage(specChallengeMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := AuthenticateMessage(challenge, specDomain, specUser, NTHash(specPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg[:8], signature) || binary.LittleEndian.Uint32(msg[8:]) != 3 {
+		t.Fatalf("AuthenticateMessage() = %x, not an authenticate message", msg)
+	}
+	ntResponse, err := readField(msg, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	domain, _ := readField(msg, 28)
+	user, _ := readField(msg, 36)
+	if fromUTF16le(domain) != specDomain || fromUTF16le(user) != specUser {
+		t.Errorf("AuthenticateMessage() is for %s\\%s", fromUTF16le(domain), fromUTF16le(user))
+	}
+
+	// The server checks the NTProofStr against the client challenge structure that follows it
+	key := ntowfv2(NTHash(specPassword), specUser, specDomain)
+	if proof := hmacMD5(key, append(bytes.Clone(specServerChallenge), ntResponse[16:]...)); !bytes.Equal(proof, ntResponse[:16]) {
+		t.Errorf("NTProofStr = %x, want %x", ntResponse[:16], proof)
+	}
+
+	if _, err := AuthenticateMessage(challenge, specDomain, specUser, []byte{1, 2, 3}); err == nil {
+		t.Error("AuthenticateMessage() accepted a short NT hash")
+	}
+}
+
+// encodeChallenge is the server side of ParseChallengeMessage
+func encodeChallenge(c *ChallengeMessage) []byte {
+	const headerSize = 56
+	targetName := utf16le(c.TargetName)
+	msg := make([]byte, headerSize)
+	copy(msg, signature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint16(msg[12:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint16(msg[14:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint32(msg[16:], headerSize)
+	binary.LittleEndian.PutUint32(msg[20:], c.Flags)
+	copy(msg[24:], c.ServerChallenge[:])
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(c.TargetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(c.TargetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], uint32(headerSize+len(targetName)))
+	if c.Version != nil {
+		msg[48], msg[49] = c.Version.Major, c.Version.Minor
+		binary.LittleEndian.PutUint16(msg[50:], c.Version.Build)
+		msg[55] = c.Version.Revision
+	}
+	msg = append(msg, targetName...)
+	return append(msg, c.TargetInfo...)
+}
+
+// avPairs encodes names as an AV_PAIR list, followed by timestamp if it is not nil
+func avPairs(names map[uint16]string, timestamp []byte) []byte {
+	var list []byte
+	pair := func(id uint16, value []byte) {
+		list = binary.LittleEndian.AppendUint16(list, id)
+		list = binary.LittleEndian.AppendUint16(list, uint16(len(value)))
+		list = append(list, value...)
+	}
+	for _, id := range []uint16{avNbDomainName, avNbComputerName, avDNSDomainName, avDNSComputerName, avDNSTreeName} {
+		if name, ok := names[id]; ok {
+			pair(id, utf16le(name))
+		}
+	}
+	if timestamp != nil {
+		pair(avTimestamp, timestamp)
+	}
+	pair(avEOL, nil)
+	return list
+}
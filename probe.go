@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"sccm-http-looter/looter"
+)
+
+// runProbe is the probe subcommand: it checks what each DP allows without looting it, prints a
+// capability matrix and saves the details of every DP to probe.json
+func runProbe(args []string) {
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	targetArgs := addTargetFlags(fs)
+	clientArgs := addClientFlags(fs)
+	outputDir := fs.String("output", "./loot", "The base output directory, probe.json is saved to it (or to the subdirectory of each DP with -targets)")
+	threads := fs.Int("threads", 4, "Number of DPs probed at once")
+	rate := fs.Float64("rate", 0, "Maximum requests per second to each DP (0 for no limit)")
+	verbose := fs.Bool("verbose", false, "print debug/error statements")
+	fs.Parse(args)
+
+	slog.Info("SCCM HTTP Looter by Bad Sector Labs (@badsectorlabs)")
+
+	if *verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	targets, err := targetArgs.targets()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	clientConfig, err := clientArgs.config(targets)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	client, err := looter.NewHTTPClient(clientConfig)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Unable to create HTTP client: %v", err))
+		os.Exit(1)
+	}
+	// Anonymous access is tested even with credentials
+	anonymous := client
+	credentials := clientConfig.Credentials != nil
+	if credentials {
+		clientConfig.Credentials = nil
+		if anonymous, err = looter.NewHTTPClient(clientConfig); err != nil {
+			slog.Error(fmt.Sprintf("Unable to create HTTP client: %v", err))
+			os.Exit(1)
+		}
+	}
+
+	results := make([]*looter.ProbeResult, len(targets))
+	slots := make(chan struct{}, max(*threads, 1))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		opts := looter.Options{
+			OutputDir:         *outputDir,
+			RequestsPerSecond: *rate,
+			// A probe reports what a single request gets
+			Retry: looter.RetryPolicy{MaxAttempts: 1},
+		}
+		if *targetArgs.targetsPath != "" {
+			opts.OutputDir = filepath.Join(*outputDir, looter.TargetDirName(target))
+		}
+		l, err := looter.New(target, client, opts)
+		if err != nil {
+			slog.Error(fmt.Sprintf("%s: %v", target, err))
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, l *looter.Looter) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			slog.Info(fmt.Sprintf("Probing %s...", l.BaseURL))
+			results[i] = l.Probe(anonymous)
+			if err := saveProbe(results[i], l.OutputDir); err != nil {
+				slog.Error(fmt.Sprintf("Error writing probe result: %v", err))
+			}
+		}(i, l)
+	}
+	wg.Wait()
+
+	printCapabilities(results, credentials)
+}
+
+// saveProbe saves result to probe.json in outputDir
+func saveProbe(result *looter.ProbeResult, outputDir string) error {
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return err
+	}
+	return result.Save(filepath.Join(outputDir, looter.ProbeFileName))
+}
+
+// printCapabilities prints the capability matrix of the probed DPs, with the options to loot each one
+func printCapabilities(results []*looter.ProbeResult, credentials bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tANONYMOUS\tAUTH\tSCHEMES\tBROWSING\tLISTING\tSIGNATURES\tFILELIB\tNOCERT_\tCCMTOKENAUTH_\tHTTP\tHTTPS\tUSE")
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		httpStatus := string(result.HTTP)
+		if strings.HasPrefix(strings.ToLower(result.HTTPRedirect), "https://") {
+			httpStatus = "redirect"
+		}
+		schemes := strings.Join(result.AuthSchemes, ",")
+		if schemes == "" {
+			schemes = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", result.Target, result.Anonymous, result.Authenticated, schemes,
+			result.Browsing, result.PackageListing, result.Signatures, result.FileLib, result.NoCert, result.CCMTokenAuth, httpStatus, result.HTTPS, suggestedOptions(result, credentials))
+	}
+	w.Flush()
+
+	// Where the DP sits in AD, from its NTLM challenge
+	for _, result := range results {
+		if result == nil || result.NTLM == nil {
+			continue
+		}
+		info := result.NTLM
+		fmt.Printf("%s: %s\\%s, %s in domain %s (forest %s), OS version %s\n", result.Target, info.NetBIOSDomainName, info.NetBIOSComputerName,
+			info.DNSComputerName, info.DNSDomainName, info.DNSTreeName, info.OSVersion)
+	}
+}
+
+// suggestedOptions returns the options of the main mode that will work on the DP of result
+func suggestedOptions(result *looter.ProbeResult, credentials bool) string {
+	var options []string
+	switch len(result.Methods) {
+	case 0:
+		if result.Anonymous != looter.ProbeYes && len(result.AuthSchemes) > 0 && !credentials {
+			return "-username (credentials needed)"
+		}
+		return "none"
+	case 1:
+		options = append(options, "-method "+result.Methods[0])
+	default:
+		options = append(options, "-method auto")
+	}
+	if result.Anonymous != looter.ProbeYes {
+		options = append(options, "-username")
+	}
+	return strings.Join(options, " ")
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"sccm-http-looter/analyze"
+	"sccm-http-looter/looter"
+)
+
+// runScan is the scan subcommand: it scans the files of previous runs for credentials and secrets
+func runScan(args []string) {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s scan [options] <output directory or file> ...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	outputPath := flags.String("output", "", "File the findings of every path are written to, with the credentials, deployments and certificates in "+analyze.CredentialsFileName+", "+analyze.DeploymentsFileName+" and "+analyze.KeyMaterialFileName+" next to it (default <output directory>/"+analyze.FindingsFileName+")")
+	passwordsPath := flags.String("passwords", "", "Path to a file of passwords to try on PKCS#12 files and Java key stores, one per line, after the common ones")
+	verbose := flags.Bool("verbose", false, "print debug/error statements")
+	flags.Parse(args)
+
+	slog.Info("SCCM HTTP Looter by Bad Sector Labs (@badsectorlabs)")
+
+	if *verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	passwords, err := readPasswords(*passwordsPath)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	scanner := analyze.NewScanner()
+	var shared *analysis
+	if *outputPath != "" {
+		shared = newAnalysis(scanner, passwords, *outputPath, false)
+	}
+
+	counts := make(map[string]int)
+	for _, path := range flags.Args() {
+		a := shared
+		if a == nil {
+			dir := path
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				dir = filepath.Dir(path)
+			}
+			a = newAnalysis(scanner, passwords, filepath.Join(dir, analyze.FindingsFileName), false)
+		}
+		err := a.scanPath(path)
+		if a != shared {
+			err = errors.Join(err, a.Close())
+			for name, count := range a.counts {
+				counts[name] += count
+			}
+		}
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error scanning %s: %v", path, err))
+			os.Exit(1)
+		}
+	}
+	if shared != nil {
+		if err := shared.Close(); err != nil {
+			slog.Error(fmt.Sprintf("Error writing findings: %v", err))
+			os.Exit(1)
+		}
+		counts = shared.counts
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FOUND\tCOUNT")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%d\n", name, counts[name])
+	}
+	w.Flush()
+}
+
+// analysis scans the files of a DP for secrets, decrypts their GPP passwords, extracts the
+// credentials they store, lists the steps of task sequences and applications and describes
+// certificates and keys, writing what it finds to a findings, a credentials, a deployments and a
+// certificates file. It is safe for concurrent use.
+type analysis struct {
+	// scanner is nil when files are not scanned for secrets
+	scanner *analyze.Scanner
+	// passwords are tried on PKCS#12 files and key stores
+	passwords   []string
+	findings    *analyze.FindingsFile
+	credentials *analyze.CredentialsFile
+	deployments *analyze.DeploymentsFile
+	keys        *analyze.KeyMaterialFile
+
+	// queue feeds the downloaded files to the workers analyzing them, so that key material with
+	// costly passwords does not hold up the download workers
+	queue        chan looter.ManifestRecord
+	startWorkers sync.Once
+	workers      sync.WaitGroup
+
+	mu sync.Mutex
+	// counts are the findings by rule, the credentials by source, the deployments by kind and the key
+	// material by format
+	counts map[string]int
+}
+
+// newAnalysis returns an analysis writing its findings to findingsPath, and its credentials,
+// deployments and certificates next to it
+func newAnalysis(scanner *analyze.Scanner, passwords []string, findingsPath string, appending bool) *analysis {
+	dir := filepath.Dir(findingsPath)
+	return &analysis{
+		scanner:     scanner,
+		passwords:   passwords,
+		findings:    analyze.NewFindingsFile(findingsPath, appending),
+		credentials: analyze.NewCredentialsFile(filepath.Join(dir, analyze.CredentialsFileName), appending),
+		deployments: analyze.NewDeploymentsFile(filepath.Join(dir, analyze.DeploymentsFileName), appending),
+		keys:        analyze.NewKeyMaterialFile(filepath.Join(dir, analyze.KeyMaterialFileName), appending),
+		counts:      make(map[string]int),
+	}
+}
+
+// analysisQueueSize is the number of downloaded files waiting to be analyzed before the download
+// workers wait for the analysis
+const analysisQueueSize = 256
+
+// onDownload is the OnDownload hook of a Looter. The file is queued for the analysis workers, which
+// are started with the first file.
+func (a *analysis) onDownload(record looter.ManifestRecord) {
+	a.startWorkers.Do(func() {
+		a.queue = make(chan looter.ManifestRecord, analysisQueueSize)
+		for range runtime.NumCPU() {
+			a.workers.Add(1)
+			go func() {
+				defer a.workers.Done()
+				for record := range a.queue {
+					if err := a.analyzeFile(record.LocalPath, record); err != nil {
+						slog.Error(fmt.Sprintf("Error analyzing %s: %v", record.LocalPath, err))
+					}
+				}
+			}()
+		}
+	})
+	a.queue <- record
+}
+
+// analyzeFile scans the file at filePath, which record locates on the DP, decrypts its GPP passwords,
+// extracts its credentials, lists its steps if it is a task sequence or an application and describes
+// it if it is a certificate or key
+func (a *analysis) analyzeFile(filePath string, record looter.ManifestRecord) error {
+	// The file is read and decoded once for every analyzer
+	doc, err := analyze.ReadDocument(filePath)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Error reading %s: %v", filePath, err))
+		return nil
+	}
+	// With -link none the file is a blob named after its hash
+	doc.Name = record.OriginalPath
+	var findings []analyze.Finding
+	if a.scanner != nil {
+		findings = a.scanner.ScanDocument(doc)
+	}
+	gppPasswords := doc.GPPPasswords()
+	if len(gppPasswords) > 0 {
+		// The scanner flags the cpassword attributes too, without decrypting them
+		findings = slices.DeleteFunc(findings, func(finding analyze.Finding) bool {
+			return slices.ContainsFunc(gppPasswords, func(gpp analyze.Finding) bool { return gpp.Line == finding.Line })
+		})
+		findings = append(gppPasswords, findings...)
+	}
+	credentials := doc.Credentials()
+	deployment := doc.Deployment()
+	material := doc.KeyMaterial(a.passwords)
+	if len(findings) == 0 && len(credentials) == 0 && deployment == nil && material == nil {
+		return nil
+	}
+
+	name := filePath
+	if record.OriginalPath != "" {
+		name = fmt.Sprintf("%s (%s)", record.OriginalPath, record.ContentID)
+	}
+	a.mu.Lock()
+	for i := range findings {
+		findings[i].ContentID, findings[i].OriginalPath = record.ContentID, record.OriginalPath
+		a.counts[findings[i].Rule]++
+	}
+	for i := range credentials {
+		credentials[i].ContentID, credentials[i].OriginalPath = record.ContentID, record.OriginalPath
+		a.counts[credentials[i].Source]++
+	}
+	if deployment != nil {
+		deployment.ContentID, deployment.OriginalPath = record.ContentID, record.OriginalPath
+		a.counts[deployment.Kind]++
+	}
+	if material != nil {
+		material.ContentID, material.OriginalPath = record.ContentID, record.OriginalPath
+		a.counts[material.Format]++
+		if material.ClientAuth && material.PrivateKey {
+			a.counts["client-auth-key"]++
+		}
+	}
+	a.mu.Unlock()
+
+	for _, finding := range gppPasswords {
+		slog.Info(fmt.Sprintf("Decrypted the GPP password of %s in %s", finding.User, name))
+	}
+	if others := len(findings) - len(gppPasswords); others > 0 {
+		slog.Info(fmt.Sprintf("%d possible secrets in %s", others, name))
+	}
+	for _, credential := range credentials {
+		slog.Info(fmt.Sprintf("Decoded the %s credential of %s in %s", credential.Source, account(credential), name))
+	}
+	errs := []error{a.findings.Write(findings...), a.credentials.Write(credentials...)}
+	if deployment != nil {
+		slog.Info(fmt.Sprintf("Found the %s %q with %d steps in %s", deployment.Kind, deployment.Name, len(deployment.Steps), name))
+		errs = append(errs, a.deployments.Write(deployment))
+	}
+	if material != nil {
+		logKeyMaterial(material, name)
+		errs = append(errs, a.keys.Write(material))
+	}
+	return errors.Join(errs...)
+}
+
+// logKeyMaterial logs what matters in a certificate or key file: a client authentication certificate
+// with its private key, or a container that could not be opened
+func logKeyMaterial(material *analyze.KeyMaterial, name string) {
+	switch {
+	case material.Locked:
+		slog.Info(fmt.Sprintf("Could not open the %s file %s with the passwords tried, its hash is saved for cracking", material.Format, name))
+	case material.ClientAuth && material.PrivateKey:
+		subject := ""
+		for _, cert := range material.Certificates {
+			if cert.ClientAuth {
+				subject = cert.Subject
+				break
+			}
+		}
+		slog.Warn(fmt.Sprintf("Found a client authentication certificate with its private key for %q in %s", subject, name))
+	case material.PrivateKey:
+		slog.Info(fmt.Sprintf("Found a private key in %s", name))
+	default:
+		slog.Debug(fmt.Sprintf("Found %d certificates in %s", len(material.Certificates), name))
+	}
+	if material.Error != "" {
+		slog.Debug(fmt.Sprintf("Error reading %s: %s", name, material.Error))
+	}
+}
+
+// scanPath analyzes the file at path, or the files of an output directory (its files/ directory if
+// there is one). Files are located on the DP with the manifest of the output directory, if it has one.
+func (a *analysis) scanPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return a.analyzeFile(path, looter.ManifestRecord{})
+	}
+
+	root := path
+	if info, err := os.Stat(filepath.Join(path, "files")); err == nil && info.IsDir() {
+		root = filepath.Join(path, "files")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	records, err := readManifest(filepath.Join(path, looter.ManifestFileName), absRoot)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Files placed from the content store can be symlinks
+		if entry.IsDir() || !entry.Type().IsRegular() && entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		switch entry.Name() {
+		case analyze.FindingsFileName, analyze.CredentialsFileName, analyze.DeploymentsFileName, analyze.KeyMaterialFileName:
+			return nil
+		}
+		return a.analyzeFile(filePath, records[manifestKey(root, filePath)])
+	})
+}
+
+// Close waits for the queued files to be analyzed, then closes the findings, credentials,
+// deployments and certificates files. No file can be downloaded after it.
+func (a *analysis) Close() error {
+	a.startWorkers.Do(func() {})
+	if a.queue != nil {
+		close(a.queue)
+		a.workers.Wait()
+	}
+	return errors.Join(a.findings.Close(), a.credentials.Close(), a.deployments.Close(), a.keys.Close())
+}
+
+// readPasswords returns CommonPasswords followed by the passwords of the file at filePath, if any
+func readPasswords(filePath string) ([]string, error) {
+	passwords := slices.Clone(analyze.CommonPasswords)
+	if filePath == "" {
+		return passwords, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file: %s", filePath)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" && !slices.Contains(passwords, line) {
+			passwords = append(passwords, line)
+		}
+	}
+	return passwords, nil
+}
+
+// account returns the DOMAIN\user of a credential, or "an unknown account"
+func account(credential analyze.Credential) string {
+	switch {
+	case credential.User == "":
+		return "an unknown account"
+	case credential.Domain == "":
+		return credential.User
+	}
+	return credential.Domain + `\` + credential.User
+}
+
+// readManifest returns the downloaded files of the manifest at filePath by manifestKey, none if there
+// is no manifest. root is the absolute path of the files/ directory of the manifest.
+func readManifest(filePath, root string) (map[string]looter.ManifestRecord, error) {
+	records := make(map[string]looter.ManifestRecord)
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record looter.ManifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.LocalPath == "" {
+			continue
+		}
+		// Local paths are relative to where the run was started, which may not be here
+		localPath := record.LocalPath
+		if abs, err := filepath.Abs(localPath); err == nil && within(root, abs) {
+			localPath = abs
+		}
+		records[manifestKey(root, localPath)] = record
+	}
+	return records, scanner.Err()
+}
+
+// manifestKey returns the path of a file below root, the files/ directory of its output directory, so
+// that it does not depend on where the output directory is. A path outside of root is cut after its
+// first files/ directory.
+func manifestKey(root, filePath string) string {
+	if within(root, filePath) {
+		rel, _ := filepath.Rel(root, filePath)
+		return filepath.ToSlash(rel)
+	}
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(filePath)), "/")
+	if i := slices.Index(parts, "files"); i >= 0 {
+		parts = parts[i+1:]
+	}
+	return strings.Join(parts, "/")
+}
+
+// within returns whether filePath is below dir
+func within(dir, filePath string) bool {
+	rel, err := filepath.Rel(dir, filePath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}